@@ -0,0 +1,235 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "bufio"
+    "fmt"
+    "net"
+    "net/http"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// The AccessLogFormat type selects how AccessLogHandler() logs requests.
+type AccessLogFormat int
+
+// Formats to be used in AccessLogConfig.
+const (
+    // The Apache Common Log Format, e.g.,
+    //   127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 23
+    AccessLogCommon AccessLogFormat = iota
+    // The Apache Combined Log Format, which adds the quoted Referer and
+    // User-Agent headers to AccessLogCommon.
+    AccessLogCombined
+    // A short message, e.g., "GET /a.gif 200", with the details as fields:
+    // method, uri, proto, status, bytes, duration_ms, remote_addr, user,
+    // referer, and user_agent.
+    AccessLogFields
+)
+
+// An AccessLogConfig holds the settings for AccessLogHandler(). The zero value
+// logs every request in AccessLogCommon.
+type AccessLogConfig struct {
+    Format AccessLogFormat
+
+    // Requests for these paths are not logged, e.g., health checks. Each
+    // entry is either an exact path or a pattern as accepted by path.Match(),
+    // e.g., "/static/*".
+    ExcludePaths []string
+}
+
+type access_log_handler struct {
+    logger *Logger
+    next http.Handler
+    config AccessLogConfig
+}
+
+// Returns an http.Handler that passes each request to next and then logs it,
+// with the response status, the number of bytes in the body, and the time
+// taken. The severity depends on the status: LOG_ERR for 5xx, LOG_WARNING for
+// 4xx, and LOG_INFO otherwise. Trace IDs in the request are added as with
+// WithRequest(). If config is nil, the defaults are used.
+func (l *Logger) AccessLogHandler(next http.Handler,
+    config *AccessLogConfig) http.Handler {
+
+    h := &access_log_handler{logger: l, next: next}
+    if config != nil {
+        h.config = *config
+    }
+
+    return h
+}
+
+func (h *access_log_handler) ServeHTTP(w http.ResponseWriter,
+    r *http.Request) {
+
+    if h.excluded(r.URL.Path) {
+        h.next.ServeHTTP(w, r)
+        return
+    }
+
+    start := time.Now()
+    aw := &access_log_writer{ResponseWriter: w}
+    h.next.ServeHTTP(aw, r)
+    duration := time.Since(start)
+
+    status := aw.status
+    if status == 0 {
+        status = http.StatusOK
+    }
+
+    sev := LOG_INFO
+    switch {
+    case status >= 500:
+        sev = LOG_ERR
+    case status >= 400:
+        sev = LOG_WARNING
+    }
+
+    logger := h.logger.WithRequest(r)
+    uri := r.RequestURI
+    if uri == "" {
+        uri = r.URL.RequestURI()
+    }
+    user := "-"
+    if r.URL.User != nil && r.URL.User.Username() != "" {
+        user = r.URL.User.Username()
+    } else if name, _, ok := r.BasicAuth(); ok && name != "" {
+        user = name
+    }
+
+    if h.config.Format == AccessLogFields {
+        logger = logger.With("method", r.Method, "uri", uri,
+            "proto", r.Proto, "status", status, "bytes", aw.bytes,
+            "duration_ms", float64(duration.Microseconds()) / 1000,
+            "remote_addr", r.RemoteAddr, "user", user,
+            "referer", r.Referer(), "user_agent", r.UserAgent())
+        logger.log_sev(0, sev, fmt.Sprintf("%s %s %d", r.Method, uri, status))
+        return
+    }
+
+    bytes_str := "-"
+    if aw.bytes > 0 {
+        bytes_str = strconv.FormatInt(aw.bytes, 10)
+    }
+    host := r.RemoteAddr
+    if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+        host = h
+    }
+
+    m := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`, host,
+        clf_escape(user), start.Format("02/Jan/2006:15:04:05 -0700"),
+        clf_escape(r.Method), clf_escape(uri), clf_escape(r.Proto), status,
+        bytes_str)
+    if h.config.Format == AccessLogCombined {
+        m += fmt.Sprintf(` "%s" "%s"`, clf_escape(r.Referer()),
+            clf_escape(r.UserAgent()))
+    }
+
+    logger.log_sev(0, sev, m)
+}
+
+func (h *access_log_handler) excluded(req_path string) bool {
+    for _, pattern := range h.config.ExcludePaths {
+        if pattern == req_path {
+            return true
+        }
+        if matched, _ := path.Match(pattern, req_path); matched {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Escapes quotes, backslashes, and non-printable characters as Apache does.
+func clf_escape(s string) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case c == '"' || c == '\\':
+            b.WriteByte('\\')
+            b.WriteByte(c)
+        case c < 0x20 || c >= 0x7f:
+            fmt.Fprintf(&b, `\x%02x`, c)
+        default:
+            b.WriteByte(c)
+        }
+    }
+
+    return b.String()
+}
+
+// An http.ResponseWriter that keeps track of the status and body size.
+type access_log_writer struct {
+    http.ResponseWriter
+    status int
+    bytes int64
+}
+
+func (w *access_log_writer) WriteHeader(status int) {
+    if w.status == 0 {
+        w.status = status
+    }
+    w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *access_log_writer) Write(b []byte) (int, error) {
+    if w.status == 0 {
+        w.status = http.StatusOK
+    }
+    n, err := w.ResponseWriter.Write(b)
+    w.bytes += int64(n)
+
+    return n, err
+}
+
+// Passes on flushes, for streaming responses.
+func (w *access_log_writer) Flush() {
+    if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
+
+// Passes on hijacking, for websockets.
+func (w *access_log_writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    hijacker, ok := w.ResponseWriter.(http.Hijacker)
+    if !ok {
+        return nil, nil, fmt.Errorf("ResponseWriter doesn't support hijacking")
+    }
+
+    return hijacker.Hijack()
+}
+
+// Returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *access_log_writer) Unwrap() http.ResponseWriter {
+    return w.ResponseWriter
+}
@@ -0,0 +1,148 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+type AccessLogTest struct {
+    Name string
+    Format log.AccessLogFormat
+    Status int
+    Expected []string
+}
+
+func TestAccessLogHandler(t *testing.T) {
+    tests := []*AccessLogTest{
+        &AccessLogTest{"common", log.AccessLogCommon, http.StatusOK,
+            []string{`INFO p: accesslog.go:`,
+                `: 192.0.2.1 - frank [`,
+                `] "GET /a?b=\"c\" HTTP/1.1" 200 5` + "\n"}},
+        &AccessLogTest{"combined", log.AccessLogCombined, http.StatusNotFound,
+            []string{`WARNING p: `,
+                `"GET /a?b=\"c\" HTTP/1.1" 404 5 "http://ref/" "agent/1.0"` +
+                    "\n"}},
+        &AccessLogTest{"fields", log.AccessLogFields, http.StatusBadGateway,
+            []string{`ERR p: `, `: GET /a?b="c" 502`, `status=502`,
+                `bytes=5`, `remote_addr=192.0.2.1:1234`, `user=frank`,
+                `user_agent=agent/1.0`, `duration_ms=`}},
+    }
+
+    for _, tester := range tests {
+        t.Run(tester.Name, func(t *testing.T) {
+            buffer := new(bytes.Buffer)
+            logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+            logger.SetTimestampFunc(nil)
+            logger.SetSeverityLabel(log.LabelUpper)
+
+            status := tester.Status
+            handler := logger.AccessLogHandler(http.HandlerFunc(
+                func(w http.ResponseWriter, r *http.Request) {
+                    w.WriteHeader(status)
+                    w.Write([]byte("hello"))
+                }), &log.AccessLogConfig{Format: tester.Format})
+
+            r := httptest.NewRequest("GET", `/a?b="c"`, nil)
+            r.RemoteAddr = "192.0.2.1:1234"
+            r.SetBasicAuth("frank", "secret")
+            r.Header.Set("Referer", "http://ref/")
+            r.Header.Set("User-Agent", "agent/1.0")
+            handler.ServeHTTP(httptest.NewRecorder(), r)
+
+            output := buffer.String()
+            for _, expected := range tester.Expected {
+                if !strings.Contains(output, expected) {
+                    t.Errorf("%q not found in %q", expected, output)
+                }
+            }
+        })
+    }
+}
+
+func TestAccessLogHandlerDefaults(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "")
+    logger.SetTimestampFunc(nil)
+
+    handler := logger.AccessLogHandler(http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {}), nil)
+    handler.ServeHTTP(httptest.NewRecorder(),
+        httptest.NewRequest("GET", "/", nil))
+
+    if !strings.HasSuffix(buffer.String(), `"GET / HTTP/1.1" 200 -` + "\n") {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+}
+
+func TestAccessLogHandlerExclude(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "")
+
+    served := 0
+    handler := logger.AccessLogHandler(http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {
+            served++
+        }), &log.AccessLogConfig{
+            ExcludePaths: []string{"/healthz", "/static/*"},
+        })
+
+    for _, req_path := range []string{"/healthz", "/static/a.css", "/x"} {
+        handler.ServeHTTP(httptest.NewRecorder(),
+            httptest.NewRequest("GET", req_path, nil))
+    }
+
+    if served != 3 {
+        t.Errorf("served %d requests, expected 3", served)
+    }
+    if strings.Count(buffer.String(), "\n") != 1 ||
+        !strings.Contains(buffer.String(), `"GET /x `) {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+}
+
+func TestAccessLogHandlerTrace(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "")
+
+    handler := logger.AccessLogHandler(http.HandlerFunc(
+        func(w http.ResponseWriter, r *http.Request) {}), nil)
+    r := httptest.NewRequest("GET", "/", nil)
+    r.Header.Set(log.TraceparentHeader,
+        "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    handler.ServeHTTP(httptest.NewRecorder(), r)
+
+    if !strings.Contains(buffer.String(),
+        "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") {
+        t.Errorf("trace ID not logged: %q", buffer.String())
+    }
+}
@@ -0,0 +1,298 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "bufio"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// The marker that introduces the sequence number and hash at the end of each
+// audit record.
+const audit_marker = " #audit:"
+
+// How much of the end of an existing audit file is read at a time when looking
+// for the last record.
+const audit_tail_size = 64 * 1024
+
+var audit_suffix_re = regexp.MustCompile(` #audit:(\d+):([0-9a-f]{64})$`)
+
+// An AuditWriter is an io.Writer for tamper-evident audit logs. Each write is
+// treated as one record, and is appended to the file with a sequence number
+// and an HMAC-SHA256 hash that covers the record and the hash of the previous
+// record, e.g.,
+//
+//   2020-01-02T03:04:05Z main.go:12: user bob deleted 3 files #audit:42:9f86...
+//
+// so that changing, removing, or reordering records breaks the chain. Use
+// Verify() or "golog verify" to check a file. Note that records removed from
+// the end of the file cannot be detected this way.
+//
+// Each record is written on a single line, with newlines escaped as with
+// MultilineEscape, so a message can't pass itself off as more than one record.
+//
+// Pass it to New() or SetOutput() to log to it.
+type AuditWriter struct {
+    lock sync.Mutex
+    fh *os.File
+    key []byte
+    seq uint64
+    last string
+}
+
+// Opens the audit file at file_path for appending, creating it if needed, and
+// hashing records with key. If the file already has records, the chain
+// continues from the last one. A partial line left at the end of the file by
+// an interrupted write is removed.
+func NewAuditWriter(file_path string, key []byte) (*AuditWriter, error) {
+    if len(key) == 0 {
+        return nil, fmt.Errorf("Audit key must not be empty")
+    }
+
+    fh, err := os.OpenFile(file_path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+    if err != nil {
+        return nil, err
+    }
+
+    w := &AuditWriter{fh: fh, key: append([]byte(nil), key...)}
+    var end int64
+    if w.seq, w.last, end, err = audit_tail(fh); err == nil {
+        err = fh.Truncate(end)
+    }
+    if err != nil {
+        fh.Close()
+        return nil, fmt.Errorf("Couldn't resume audit log %s: %s", file_path,
+            err)
+    }
+
+    return w, nil
+}
+
+// Writes b as one audit record. A trailing newline in b is not part of the
+// record. Any other newlines, carriage returns, and backslashes are escaped
+// as with MultilineEscape, so that each record is a single line.
+func (w *AuditWriter) Write(b []byte) (int, error) {
+    content := strings.TrimSuffix(string(b), "\n")
+    content = multiline_escaper.Replace(content)
+
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    if w.fh == nil {
+        return 0, fmt.Errorf("Audit writer is closed")
+    }
+
+    seq := w.seq + 1
+    sum := audit_hmac(w.key, w.last, seq, content)
+    line := content + audit_marker + strconv.FormatUint(seq, 10) + ":" + sum +
+        "\n"
+    if _, err := io.WriteString(w.fh, line); err != nil {
+        return 0, err
+    }
+    w.seq = seq
+    w.last = sum
+
+    return len(b), nil
+}
+
+// Returns the sequence number of the last record written.
+func (w *AuditWriter) Sequence() uint64 {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    return w.seq
+}
+
+// Commits the file to stable storage.
+func (w *AuditWriter) Sync() error {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    if w.fh == nil {
+        return nil
+    }
+
+    return w.fh.Sync()
+}
+
+// Closes the file.
+func (w *AuditWriter) Close() error {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    if w.fh == nil {
+        return nil
+    }
+    err := w.fh.Close()
+    w.fh = nil
+
+    return err
+}
+
+// An AuditError is returned by Verify() for the first record that is missing
+// or fails verification. Line is the line number where the record starts.
+type AuditError struct {
+    Line int
+    Seq uint64
+    Err error
+}
+
+func (e *AuditError) Error() string {
+    return fmt.Sprintf("Audit record %d at line %d: %s", e.Seq, e.Line, e.Err)
+}
+
+// Checks the audit log in r, as written by an AuditWriter with key, one record
+// per line. The log must start with the first record. Returns an *AuditError
+// for the first record that was altered, is out of order, or follows missing
+// records.
+func Verify(r io.Reader, key []byte) error {
+    br := bufio.NewReader(r)
+    var seq uint64
+    last := ""
+    line_num := 0
+
+    for {
+        line, err := br.ReadString('\n')
+        if err != nil && err != io.EOF {
+            return err
+        }
+        if line == "" && err == io.EOF {
+            break
+        }
+        line_num++
+        line = strings.TrimSuffix(line, "\n")
+
+        m := audit_suffix_re.FindStringSubmatchIndex(line)
+        if m == nil {
+            return &AuditError{Line: line_num, Seq: seq + 1,
+                Err: fmt.Errorf("no sequence number and hash")}
+        }
+
+        content := line[:m[0]]
+        rec_seq, perr := strconv.ParseUint(line[m[2]:m[3]], 10, 64)
+        if perr != nil {
+            return &AuditError{Line: line_num, Seq: seq + 1, Err: perr}
+        }
+        sum := line[m[4]:m[5]]
+
+        switch {
+        case rec_seq > seq + 1:
+            return &AuditError{Line: line_num, Seq: seq + 1,
+                Err: fmt.Errorf("missing, next record is %d", rec_seq)}
+        case rec_seq <= seq:
+            return &AuditError{Line: line_num, Seq: rec_seq,
+                Err: fmt.Errorf("out of sequence after record %d", seq)}
+        }
+
+        expected := audit_hmac(key, last, rec_seq, content)
+        if !hmac.Equal([]byte(sum), []byte(expected)) {
+            return &AuditError{Line: line_num, Seq: rec_seq,
+                Err: fmt.Errorf("hash mismatch")}
+        }
+        seq = rec_seq
+        last = sum
+
+        if err == io.EOF {
+            break
+        }
+    }
+
+    return nil
+}
+
+// Returns the hex-encoded hash of a record, chained to the previous hash.
+func audit_hmac(key []byte, prev string, seq uint64, content string) string {
+    mac := hmac.New(sha256.New, key)
+    io.WriteString(mac, prev)
+    io.WriteString(mac, ":")
+    io.WriteString(mac, strconv.FormatUint(seq, 10))
+    io.WriteString(mac, ":")
+    io.WriteString(mac, content)
+
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns the sequence number and hash of the last record in fh, reading
+// backwards from the end until a record is found, and the size of the file up
+// to the end of its last complete line.
+func audit_tail(fh *os.File) (uint64, string, int64, error) {
+    info, err := fh.Stat()
+    if err != nil {
+        return 0, "", 0, err
+    }
+    size := info.Size()
+    end := int64(-1)
+
+    for n := int64(audit_tail_size); size > 0; n *= 2 {
+        offset := size - n
+        if offset < 0 {
+            offset = 0
+        }
+        buf := make([]byte, size - offset)
+        if _, err := fh.ReadAt(buf, offset); err != nil && err != io.EOF {
+            return 0, "", 0, err
+        }
+
+        // Only complete lines are considered. Anything after the last newline
+        // was left by an interrupted write.
+        lines := strings.Split(string(buf), "\n")
+        partial := lines[len(lines) - 1]
+        lines = lines[:len(lines) - 1]
+        if end < 0 && (len(lines) > 0 || offset == 0) {
+            end = size - int64(len(partial))
+        }
+        for i := len(lines) - 1; i >= 0; i-- {
+            m := audit_suffix_re.FindStringSubmatch(lines[i])
+            if m == nil {
+                continue
+            }
+            seq, err := strconv.ParseUint(m[1], 10, 64)
+            if err != nil {
+                return 0, "", 0, err
+            }
+            return seq, m[2], end, nil
+        }
+
+        if offset == 0 {
+            if end > 0 {
+                return 0, "", 0, fmt.Errorf("No audit record found")
+            }
+            break
+        }
+    }
+
+    return 0, "", 0, nil
+}
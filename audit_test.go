@@ -0,0 +1,212 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+var audit_key = []byte("secret")
+
+// Writes an audit log with the given messages, returning its path and the
+// directory to remove.
+func write_audit_log(t *testing.T, messages ...string) (string, string) {
+    dir, err := ioutil.TempDir("", "audit_test")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+    file_path := filepath.Join(dir, "audit.log")
+
+    w, err := log.NewAuditWriter(file_path, audit_key)
+    if err != nil {
+        os.RemoveAll(dir)
+        t.Fatalf("couldn't open audit log: %s", err)
+    }
+    logger := log.New(w, log.LOG_DEBUG, "")
+    for _, m := range messages {
+        logger.Info(m)
+    }
+    w.Close()
+
+    return file_path, dir
+}
+
+func TestAuditWriterResume(t *testing.T) {
+    file_path, dir := write_audit_log(t, "one", "two\ncontinued")
+    defer os.RemoveAll(dir)
+
+    w, err := log.NewAuditWriter(file_path, audit_key)
+    if err != nil {
+        t.Fatalf("couldn't reopen audit log: %s", err)
+    }
+    if w.Sequence() != 2 {
+        t.Errorf("resumed at sequence %d, expected 2", w.Sequence())
+    }
+    log.New(w, log.LOG_DEBUG, "").Info("three")
+    w.Close()
+
+    data, err := ioutil.ReadFile(file_path)
+    if err != nil {
+        t.Fatalf("couldn't read audit log: %s", err)
+    }
+    lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+    if len(lines) != 3 || !strings.Contains(lines[1], `: two\ncontinued #`) ||
+        !strings.Contains(lines[2], ": three #audit:3:") {
+        t.Errorf("unexpected audit log %q", data)
+    }
+
+    if err := log.Verify(bytes.NewReader(data), audit_key); err != nil {
+        t.Errorf("verification failed: %s", err)
+    }
+    if err := log.Verify(bytes.NewReader(data), []byte("wrong")); err == nil {
+        t.Errorf("verification passed with the wrong key")
+    }
+}
+
+type AuditVerifyTest struct {
+    Name string
+    Tamper func(lines []string) []string
+    Line int
+    Seq uint64
+}
+
+func TestVerify(t *testing.T) {
+    file_path, dir := write_audit_log(t, "one", "two", "three", "four")
+    defer os.RemoveAll(dir)
+
+    data, err := ioutil.ReadFile(file_path)
+    if err != nil {
+        t.Fatalf("couldn't read audit log: %s", err)
+    }
+
+    tests := []*AuditVerifyTest{
+        &AuditVerifyTest{"altered", func(lines []string) []string {
+            lines[1] = strings.Replace(lines[1], "two", "TWO", 1)
+            return lines
+        }, 2, 2},
+        &AuditVerifyTest{"removed", func(lines []string) []string {
+            return append(lines[:1], lines[2:]...)
+        }, 2, 2},
+        &AuditVerifyTest{"reordered", func(lines []string) []string {
+            lines[1], lines[2] = lines[2], lines[1]
+            return lines
+        }, 2, 2},
+        &AuditVerifyTest{"inserted", func(lines []string) []string {
+            return append([]string{lines[0], "injected"}, lines[1:]...)
+        }, 2, 2},
+    }
+
+    for _, tester := range tests {
+        t.Run(tester.Name, func(t *testing.T) {
+            lines := strings.Split(strings.TrimSuffix(string(data), "\n"),
+                "\n")
+            lines = tester.Tamper(lines)
+            input := strings.Join(lines, "\n") + "\n"
+
+            err := log.Verify(strings.NewReader(input), audit_key)
+            audit_err, ok := err.(*log.AuditError)
+            if !ok {
+                t.Fatalf("expected an *AuditError, got %v", err)
+            }
+            if audit_err.Line != tester.Line || audit_err.Seq != tester.Seq {
+                t.Errorf("got %s, expected record %d at line %d", err,
+                    tester.Seq, tester.Line)
+            }
+        })
+    }
+}
+
+func TestVerifyForgedMarker(t *testing.T) {
+    forged := "one #audit:7:" + strings.Repeat("0", 64) + "\nfake"
+    file_path, dir := write_audit_log(t, forged, "two")
+    defer os.RemoveAll(dir)
+
+    data, err := ioutil.ReadFile(file_path)
+    if err != nil {
+        t.Fatalf("couldn't read audit log: %s", err)
+    }
+    if err := log.Verify(bytes.NewReader(data), audit_key); err != nil {
+        t.Errorf("verification failed: %s", err)
+    }
+}
+
+func TestAuditWriterPartialLine(t *testing.T) {
+    file_path, dir := write_audit_log(t, "one", "two")
+    defer os.RemoveAll(dir)
+
+    fh, err := os.OpenFile(file_path, os.O_WRONLY|os.O_APPEND, 0600)
+    if err != nil {
+        t.Fatalf("couldn't open audit log: %s", err)
+    }
+    fh.WriteString("partial write before a cra")
+    fh.Close()
+
+    w, err := log.NewAuditWriter(file_path, audit_key)
+    if err != nil {
+        t.Fatalf("couldn't reopen audit log: %s", err)
+    }
+    log.New(w, log.LOG_DEBUG, "").Info("three")
+    w.Close()
+
+    data, err := ioutil.ReadFile(file_path)
+    if err != nil {
+        t.Fatalf("couldn't read audit log: %s", err)
+    }
+    if strings.Contains(string(data), "partial") {
+        t.Errorf("partial line wasn't removed: %q", data)
+    }
+    if err := log.Verify(bytes.NewReader(data), audit_key); err != nil {
+        t.Errorf("verification failed: %s", err)
+    }
+}
+
+func TestAuditWriterOnlyPartialLine(t *testing.T) {
+    dir, err := ioutil.TempDir("", "audit_test")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+    defer os.RemoveAll(dir)
+    file_path := filepath.Join(dir, "audit.log")
+    if err := ioutil.WriteFile(file_path, []byte("torn"), 0600); err != nil {
+        t.Fatalf("couldn't write audit log: %s", err)
+    }
+
+    w, err := log.NewAuditWriter(file_path, audit_key)
+    if err != nil {
+        t.Fatalf("couldn't reopen audit log: %s", err)
+    }
+    if w.Sequence() != 0 {
+        t.Errorf("resumed at sequence %d, expected 0", w.Sequence())
+    }
+    w.Close()
+}
@@ -0,0 +1,112 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    log "github.com/cuberat/go-log"
+    "io/ioutil"
+    "testing"
+)
+
+// Allocations per call, as reported by "go test -bench . -benchmem" on
+// linux/amd64:
+//
+//   BenchmarkDisabled      0 allocs/op
+//   BenchmarkDisabledf     0 allocs/op
+//   BenchmarkText          3 allocs/op
+//   BenchmarkTextFields    3 allocs/op
+//   BenchmarkJSON          3 allocs/op
+//   BenchmarkParallel      3 allocs/op
+//   BenchmarkSyslog        4 allocs/op
+//
+// Disabled calls must not allocate. Enabled calls allocate the Record and the
+// timestamp, plus the string passed to the syslog method, but lines are
+// formatted in pooled buffers and the source of each call site is cached.
+
+func new_bench_logger() *log.Logger {
+    return log.New(ioutil.Discard, log.LOG_INFO, "bench: ")
+}
+
+func BenchmarkDisabled(b *testing.B) {
+    logger := new_bench_logger()
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        logger.Debug("not logged")
+    }
+}
+
+func BenchmarkDisabledf(b *testing.B) {
+    logger := new_bench_logger()
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        logger.Debugf("not logged %s", "at all")
+    }
+}
+
+func BenchmarkText(b *testing.B) {
+    logger := new_bench_logger()
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        logger.Info("a message of typical length for a log line")
+    }
+}
+
+func BenchmarkTextFields(b *testing.B) {
+    logger := new_bench_logger().With("user", "bob", "attempt", 3)
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        logger.Info("a message of typical length for a log line")
+    }
+}
+
+func BenchmarkJSON(b *testing.B) {
+    logger := new_bench_logger()
+    logger.SetFormat(log.FormatJSON)
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        logger.Info("a message of typical length for a log line")
+    }
+}
+
+func BenchmarkParallel(b *testing.B) {
+    logger := new_bench_logger()
+    b.ReportAllocs()
+    b.RunParallel(func(pb *testing.PB) {
+        for pb.Next() {
+            logger.Info("a message of typical length for a log line")
+        }
+    })
+}
+
+func BenchmarkSyslog(b *testing.B) {
+    logger := log.New(&SyslogLikeLogger{Writer: ioutil.Discard}, log.LOG_INFO,
+        "")
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        logger.Info("a message of typical length for a log line")
+    }
+}
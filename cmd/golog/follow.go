@@ -0,0 +1,142 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+    "io"
+    "os"
+    "time"
+)
+
+// How often to check a followed file for new data or rotation.
+const follow_poll_interval = 250 * time.Millisecond
+
+// A FollowReader reads a file like "tail -F": at the end of the file, it waits
+// for more data instead of returning io.EOF. If the file is renamed or removed
+// and a new one created in its place, as when it is rotated, it switches to the
+// new file once the old one is exhausted. If the file is truncated, it starts
+// again from the beginning.
+type FollowReader struct {
+    file_path string
+    fh *os.File
+    info os.FileInfo
+    offset int64
+    rotated bool
+}
+
+// Creates a FollowReader for the file at file_path. The file need not exist
+// yet.
+func NewFollowReader(file_path string) *FollowReader {
+    return &FollowReader{file_path: file_path}
+}
+
+func (fr *FollowReader) Read(b []byte) (int, error) {
+    for {
+        if fr.fh == nil {
+            if err := fr.open(); err != nil {
+                if !os.IsNotExist(err) {
+                    return 0, err
+                }
+                time.Sleep(follow_poll_interval)
+                continue
+            }
+        }
+
+        n, err := fr.fh.Read(b)
+        fr.offset += int64(n)
+        if n > 0 {
+            return n, nil
+        }
+        if err != nil && err != io.EOF {
+            return 0, err
+        }
+
+        // Data may have been written to the old file between the last read
+        // and noticing the rotation, so read it to the end once more before
+        // switching to the new file.
+        if fr.rotated {
+            fr.fh.Close()
+            fr.fh = nil
+            fr.rotated = false
+            continue
+        }
+
+        if err := fr.check_rotation(); err != nil {
+            return 0, err
+        }
+        if !fr.rotated {
+            time.Sleep(follow_poll_interval)
+        }
+    }
+}
+
+func (fr *FollowReader) open() error {
+    fh, err := os.Open(fr.file_path)
+    if err != nil {
+        return err
+    }
+
+    info, err := fh.Stat()
+    if err != nil {
+        fh.Close()
+        return err
+    }
+
+    fr.fh = fh
+    fr.info = info
+    fr.offset = 0
+    fr.rotated = false
+
+    return nil
+}
+
+// Called at the end of the current file, to see whether it has been replaced
+// or truncated.
+func (fr *FollowReader) check_rotation() error {
+    info, err := os.Stat(fr.file_path)
+    if err != nil {
+        if os.IsNotExist(err) {
+            // Rotated away, and the new file hasn't been created yet.
+            return nil
+        }
+        return err
+    }
+
+    if !os.SameFile(info, fr.info) {
+        fr.rotated = true
+        return nil
+    }
+
+    if info.Size() < fr.offset {
+        if _, err := fr.fh.Seek(0, io.SeekStart); err != nil {
+            return err
+        }
+        fr.offset = 0
+    }
+
+    return nil
+}
@@ -0,0 +1,372 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Command golog filters and converts log files written by
+// github.com/cuberat/go-log.
+//
+// Usage:
+//   golog [flags] [file ...]
+//
+// With no files, or a file of "-", it reads standard input. Records are read
+// in any of the package's formats (text, JSON, and logfmt), including
+// multi-line text messages, and written in the format selected with -format.
+//
+// Flags:
+//   -severity name   only show records at or above this severity, e.g., "warn"
+//   -keep-unknown    with -severity, also show records that have no severity
+//   -since time      only show records at or after this time
+//   -until time      only show records before this time
+//   -file pattern    only show records from source files matching pattern
+//   -grep regexp     only show records whose message matches regexp
+//   -format name     output format: raw (the default), text, json, or logfmt
+//   -F               follow files as they grow, across rotation
+//
+// Times are given in RFC 3339 format, or as a duration before now, e.g., "1h".
+//
+// To check audit logs written by an AuditWriter:
+//   golog verify (-key key | -key-file path) [file ...]
+//
+// It reports the first record in each file that was altered or is missing, and
+// exits with a non-zero status if any file fails.
+//
+// Installation:
+//   go get github.com/cuberat/go-log/cmd/golog
+package main
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    log "github.com/cuberat/go-log"
+    "io"
+    "io/ioutil"
+    "os"
+    "path"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// Conditions a record must meet to be output.
+type Filter struct {
+    Severity log.Severity
+    HasSeverity bool
+    KeepUnknown bool
+    Since time.Time
+    Until time.Time
+    FilePattern string
+    Regexp *regexp.Regexp
+}
+
+func main() {
+    if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+        fmt.Fprintf(os.Stderr, "golog: %s\n", err)
+        os.Exit(1)
+    }
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+    if len(args) > 0 && args[0] == "verify" {
+        return run_verify(args[1:], stdin, stdout)
+    }
+
+    flags := flag.NewFlagSet("golog", flag.ContinueOnError)
+    sev_name := flags.String("severity", "",
+        "only show records at or above this severity")
+    keep_unknown := flags.Bool("keep-unknown", false,
+        "with -severity, also show records that have no severity")
+    since := flags.String("since", "", "only show records at or after this time")
+    until := flags.String("until", "", "only show records before this time")
+    file_pattern := flags.String("file", "",
+        "only show records from source files matching this pattern")
+    grep := flags.String("grep", "",
+        "only show records whose message matches this regexp")
+    format_name := flags.String("format", "raw",
+        "output format: raw, text, json, or logfmt")
+    follow := flags.Bool("F", false, "follow files across rotation")
+
+    if err := flags.Parse(args); err != nil {
+        return err
+    }
+
+    filter := new(Filter)
+    filter.KeepUnknown = *keep_unknown
+    filter.FilePattern = *file_pattern
+
+    if *sev_name != "" {
+        sev, err := log.SeverityFromString(*sev_name)
+        if err != nil {
+            return err
+        }
+        filter.Severity = sev
+        filter.HasSeverity = true
+    }
+
+    var err error
+    now := time.Now()
+    if filter.Since, err = parse_time_arg(*since, now); err != nil {
+        return fmt.Errorf("Invalid -since: %s", err)
+    }
+    if filter.Until, err = parse_time_arg(*until, now); err != nil {
+        return fmt.Errorf("Invalid -until: %s", err)
+    }
+
+    if *grep != "" {
+        if filter.Regexp, err = regexp.Compile(*grep); err != nil {
+            return err
+        }
+    }
+
+    out := bufio.NewWriter(stdout)
+    defer out.Flush()
+
+    emit, err := new_emitter(*format_name, out, *follow)
+    if err != nil {
+        return err
+    }
+
+    files := flags.Args()
+    if len(files) == 0 {
+        files = []string{"-"}
+    }
+
+    records := make(chan *log.ParsedRecord)
+    errs := make(chan error, len(files))
+    for _, file_path := range files {
+        var r io.Reader
+        if file_path == "-" {
+            r = stdin
+        } else if *follow {
+            r = NewFollowReader(file_path)
+        } else {
+            fh, err := os.Open(file_path)
+            if err != nil {
+                return err
+            }
+            defer fh.Close()
+            r = fh
+        }
+
+        go read_records(r, *follow, records, errs)
+    }
+
+    for pending := len(files); pending > 0; {
+        select {
+        case rec := <-records:
+            if filter.Match(rec) {
+                if err := emit(rec); err != nil {
+                    return err
+                }
+            }
+        case err := <-errs:
+            if err != nil {
+                return err
+            }
+            pending--
+        }
+    }
+
+    return nil
+}
+
+// Sends the records read from r. When following, the last record is sent
+// once no more lines arrive for a while, rather than being held back until
+// the next line shows that it has no continuation lines.
+func read_records(r io.Reader, follow bool,
+    records chan<- *log.ParsedRecord, errs chan<- error) {
+
+    lr := log.NewReader(r)
+    if follow {
+        lr.SetFlushTimeout(follow_poll_interval)
+    }
+    for {
+        rec, err := lr.Next()
+        if err == io.EOF {
+            errs <- nil
+            return
+        }
+        if err != nil {
+            errs <- err
+            return
+        }
+        records <- rec
+    }
+}
+
+// Returns a function that writes a record in the named format. When
+// following, output is flushed after each record.
+func new_emitter(format_name string, out *bufio.Writer,
+    flush bool) (func(*log.ParsedRecord) error, error) {
+
+    var format log.Format
+    raw := format_name == "raw"
+    if !raw {
+        var err error
+        if format, err = log.FormatFromString(format_name); err != nil {
+            return nil, err
+        }
+    }
+
+    emit := func(rec *log.ParsedRecord) error {
+        var err error
+        if raw || rec.Malformed {
+            _, err = fmt.Fprintln(out, rec.Raw)
+        } else {
+            conv := rec.Record
+            if format == log.FormatText && conv.Prefix != "" &&
+                !strings.HasSuffix(conv.Prefix, " ") {
+                conv.Prefix += " "
+            }
+            _, err = out.WriteString(log.FormatRecord(format, &conv,
+                rec.Timestamp))
+        }
+        if err == nil && flush {
+            err = out.Flush()
+        }
+
+        return err
+    }
+
+    return emit, nil
+}
+
+// Reports whether the record passes the filter. Malformed records have no
+// metadata, so they can only pass conditions on the message.
+func (f *Filter) Match(rec *log.ParsedRecord) bool {
+    if f.HasSeverity {
+        if !rec.HasSeverity() {
+            if !f.KeepUnknown {
+                return false
+            }
+        } else if rec.Severity > f.Severity {
+            return false
+        }
+    }
+
+    if !f.Since.IsZero() || !f.Until.IsZero() {
+        if rec.Time.IsZero() {
+            return false
+        }
+        if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+            return false
+        }
+        if !f.Until.IsZero() && !rec.Time.Before(f.Until) {
+            return false
+        }
+    }
+
+    if f.FilePattern != "" {
+        matched, _ := path.Match(f.FilePattern, path.Base(rec.File))
+        if !matched && f.FilePattern != rec.File {
+            return false
+        }
+    }
+
+    if f.Regexp != nil && !f.Regexp.MatchString(rec.Message) {
+        return false
+    }
+
+    return true
+}
+
+// Implements the verify subcommand.
+func run_verify(args []string, stdin io.Reader, stdout io.Writer) error {
+    flags := flag.NewFlagSet("golog verify", flag.ContinueOnError)
+    key_str := flags.String("key", "", "the audit key")
+    key_file := flags.String("key-file", "",
+        "read the audit key from this file")
+
+    if err := flags.Parse(args); err != nil {
+        return err
+    }
+
+    var key []byte
+    switch {
+    case *key_str != "" && *key_file != "":
+        return fmt.Errorf("Only one of -key and -key-file may be given")
+    case *key_str != "":
+        key = []byte(*key_str)
+    case *key_file != "":
+        var err error
+        if key, err = ioutil.ReadFile(*key_file); err != nil {
+            return err
+        }
+    default:
+        return fmt.Errorf("An audit key is required, via -key or -key-file")
+    }
+
+    files := flags.Args()
+    if len(files) == 0 {
+        files = []string{"-"}
+    }
+
+    failed := 0
+    for _, file_path := range files {
+        var err error
+        if file_path == "-" {
+            err = log.Verify(stdin, key)
+        } else {
+            err = verify_file(file_path, key)
+        }
+
+        if err != nil {
+            failed++
+            fmt.Fprintf(stdout, "%s: %s\n", file_path, err)
+        } else {
+            fmt.Fprintf(stdout, "%s: OK\n", file_path)
+        }
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("%d of %d files failed verification", failed,
+            len(files))
+    }
+
+    return nil
+}
+
+func verify_file(file_path string, key []byte) error {
+    fh, err := os.Open(file_path)
+    if err != nil {
+        return err
+    }
+    defer fh.Close()
+
+    return log.Verify(fh, key)
+}
+
+// Parses a time given as RFC 3339 or as a duration before now.
+func parse_time_arg(arg string, now time.Time) (time.Time, error) {
+    if arg == "" {
+        return time.Time{}, nil
+    }
+
+    if d, err := time.ParseDuration(arg); err == nil {
+        return now.Add(-d), nil
+    }
+
+    return time.Parse(time.RFC3339Nano, arg)
+}
@@ -0,0 +1,246 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestRunFilterAndConvert(t *testing.T) {
+    input := new(bytes.Buffer)
+    logger := log.New(input, log.LOG_DEBUG, "myapp [1] ")
+    logger.SetFormat(log.FormatJSON)
+    logger.Err("disk full")
+    logger.Info("all good")
+    logger.Warning("disk slow")
+    logger.Print("no severity")
+
+    output := new(bytes.Buffer)
+    args := []string{"-severity", "warn", "-grep", "^disk", "-format",
+        "logfmt"}
+    if err := run(args, input, output); err != nil {
+        t.Fatalf("run failed: %s", err)
+    }
+
+    lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("expected 2 lines, got %q", output.String())
+    }
+    if !strings.HasPrefix(lines[0], "time=") ||
+        !strings.Contains(lines[0], `severity=err prefix="myapp [1]"`) ||
+        !strings.Contains(lines[0], `msg="disk full"`) {
+        t.Errorf("unexpected first line %q", lines[0])
+    }
+    if !strings.Contains(lines[1], `msg="disk slow"`) {
+        t.Errorf("unexpected second line %q", lines[1])
+    }
+}
+
+func TestRunConvertText(t *testing.T) {
+    input := new(bytes.Buffer)
+    logger := log.New(input, log.LOG_DEBUG, "myapp [1] ")
+    logger.SetFormat(log.FormatJSON)
+    logger.Err("disk full")
+
+    output := new(bytes.Buffer)
+    args := []string{"-format", "text"}
+    if err := run(args, input, output); err != nil {
+        t.Fatalf("run failed: %s", err)
+    }
+    if !strings.Contains(output.String(), " ERR myapp [1] ") {
+        t.Errorf("severity missing from %q", output.String())
+    }
+
+    rec := log.ParseLine(output.String())
+    if rec.Severity != log.LOG_ERR || rec.Message != "disk full" {
+        t.Errorf("couldn't read back %q: %+v", output.String(), rec)
+    }
+}
+
+func TestFilterTimeRange(t *testing.T) {
+    input := "2020-01-01T00:00:00Z a.go:1: early\n" +
+        "2020-06-01T00:00:00Z b.go:2: middle\n" +
+        "2020-12-01T00:00:00Z a.go:3: late\n"
+
+    output := new(bytes.Buffer)
+    args := []string{"-since", "2020-03-01T00:00:00Z", "-until",
+        "2020-12-01T00:00:00Z"}
+    if err := run(args, strings.NewReader(input), output); err != nil {
+        t.Fatalf("run failed: %s", err)
+    }
+    if output.String() != "2020-06-01T00:00:00Z b.go:2: middle\n" {
+        t.Errorf("unexpected output for time range: %q", output.String())
+    }
+
+    output.Reset()
+    args = []string{"-file", "a.*"}
+    if err := run(args, strings.NewReader(input), output); err != nil {
+        t.Fatalf("run failed: %s", err)
+    }
+    if strings.Count(output.String(), "\n") != 2 ||
+        strings.Contains(output.String(), "middle") {
+        t.Errorf("unexpected output for file pattern: %q", output.String())
+    }
+}
+
+func TestFollowReaderRotation(t *testing.T) {
+    dir, err := ioutil.TempDir("", "golog-follow")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    file_path := filepath.Join(dir, "app.log")
+    line := func(m string) string {
+        return "2020-01-01T00:00:00Z a.go:1: " + m + "\n"
+    }
+    err = ioutil.WriteFile(file_path, []byte(line("one")), 0644)
+    if err != nil {
+        t.Fatalf("couldn't write log file: %s", err)
+    }
+
+    // Each record is the last one in the file when it is written, so it is
+    // only seen if the reader flushes it when the file is idle.
+    records := make(chan *log.ParsedRecord, 10)
+    errs := make(chan error, 1)
+    go read_records(NewFollowReader(file_path), true, records, errs)
+
+    expect := func(expected string) {
+        select {
+        case rec := <-records:
+            if rec.Message != expected {
+                t.Errorf("expected message %q, got %q", expected,
+                    rec.Message)
+            }
+        case err := <-errs:
+            t.Fatalf("read failed: %v", err)
+        case <-time.After(5 * time.Second):
+            t.Fatalf("timed out waiting for %q", expected)
+        }
+    }
+
+    expect("one")
+
+    fh, err := os.OpenFile(file_path, os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        t.Fatalf("couldn't open log file: %s", err)
+    }
+    fh.WriteString(line("two"))
+    fh.Close()
+    expect("two")
+
+    if err := os.Rename(file_path, file_path + ".1"); err != nil {
+        t.Fatalf("couldn't rotate log file: %s", err)
+    }
+    if err := ioutil.WriteFile(file_path, []byte(line("three")),
+        0644); err != nil {
+        t.Fatalf("couldn't write new log file: %s", err)
+    }
+    expect("three")
+}
+
+func TestRunVerify(t *testing.T) {
+    dir, err := ioutil.TempDir("", "golog-verify")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+    defer os.RemoveAll(dir)
+    file_path := filepath.Join(dir, "audit.log")
+
+    w, err := log.NewAuditWriter(file_path, []byte("secret"))
+    if err != nil {
+        t.Fatalf("couldn't open audit log: %s", err)
+    }
+    logger := log.New(w, log.LOG_DEBUG, "")
+    logger.Info("one")
+    logger.Info("two")
+    w.Close()
+
+    output := new(bytes.Buffer)
+    args := []string{"verify", "-key", "secret", file_path}
+    if err := run(args, nil, output); err != nil {
+        t.Fatalf("run failed: %s", err)
+    }
+    if output.String() != file_path + ": OK\n" {
+        t.Errorf("unexpected output %q", output.String())
+    }
+
+    data, err := ioutil.ReadFile(file_path)
+    if err != nil {
+        t.Fatalf("couldn't read audit log: %s", err)
+    }
+    tampered := strings.Replace(string(data), "two", "TWO", 1)
+
+    output.Reset()
+    args = []string{"verify", "-key", "secret"}
+    if err := run(args, strings.NewReader(tampered), output); err == nil {
+        t.Errorf("tampered log passed verification")
+    }
+    if output.String() != "-: Audit record 2 at line 2: hash mismatch\n" {
+        t.Errorf("unexpected output %q", output.String())
+    }
+}
+
+func TestFollowLastRecord(t *testing.T) {
+    dir, err := ioutil.TempDir("", "golog-follow")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    file_path := filepath.Join(dir, "app.log")
+    input := "2020-01-01T00:00:00Z a.go:1: first\n" +
+        "2020-01-01T00:00:01Z a.go:2: second\n  | continued\n"
+    if err := ioutil.WriteFile(file_path, []byte(input), 0644); err != nil {
+        t.Fatalf("couldn't write log file: %s", err)
+    }
+
+    records := make(chan *log.ParsedRecord, 10)
+    errs := make(chan error, 1)
+    go read_records(NewFollowReader(file_path), true, records, errs)
+
+    for _, expected := range []string{"first", "second\ncontinued"} {
+        select {
+        case rec := <-records:
+            if rec.Message != expected {
+                t.Errorf("expected message %q, got %q", expected,
+                    rec.Message)
+            }
+        case err := <-errs:
+            t.Fatalf("read failed: %v", err)
+        case <-time.After(5 * time.Second):
+            t.Fatalf("timed out waiting for %q", expected)
+        }
+    }
+}
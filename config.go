@@ -0,0 +1,494 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Environment variables consulted by ConfigFromEnv() and Config.ApplyEnv().
+const (
+    EnvOutput = "GO_LOG_OUTPUT"
+    EnvLevel = "GO_LOG_LEVEL"
+    EnvPrefix = "GO_LOG_PREFIX"
+    EnvTimestampFormat = "GO_LOG_TIMESTAMP_FORMAT"
+    EnvTimeZone = "GO_LOG_TIME_ZONE"
+    EnvFormat = "GO_LOG_FORMAT"
+    EnvMultiline = "GO_LOG_MULTILINE"
+    EnvModules = "GO_LOG_MODULES"
+    EnvFacility = "GO_LOG_FACILITY"
+    EnvSeverityLabel = "GO_LOG_SEVERITY_LABEL"
+)
+
+// A Config describes a Logger declaratively, so that it can be loaded from a
+// JSON file or from the environment instead of being wired up by hand. Pass it
+// to NewFromConfig() to create the Logger. The zero value is a valid
+// configuration equivalent to the default logger.
+//
+// An example JSON configuration:
+//
+//   {
+//     "output": "/var/log/myapp.log",
+//     "level": "warning",
+//     "prefix": "myapp ",
+//     "timestamp_format": "rfc3339milli",
+//     "time_zone": "America/New_York",
+//     "format": "json",
+//     "multiline": "indent",
+//     "modules": {"db": "debug", "http_*": "info"},
+//     "facility": "local6",
+//     "severity_label": "upper"
+//   }
+type Config struct {
+    // Where to write log lines: "stderr" (the default), "stdout", or the path
+    // of a file to append to.
+    Output string `json:"output,omitempty"`
+
+    // The severity threshold, as accepted by SeverityFromString(). Defaults
+    // to "debug".
+    Level string `json:"level,omitempty"`
+
+    // The prefix for each log line. Defaults to the program name and process
+    // ID, as for New().
+    Prefix string `json:"prefix,omitempty"`
+
+    // The name of a timestamp generator, as accepted by
+    // TimestampFuncFromString(), a time.Format() layout prefixed with
+    // "layout:", e.g., "layout:2006-01-02 15:04:05", or "none" to leave
+    // timestamps out. Defaults to "rfc3339".
+    TimestampFormat string `json:"timestamp_format,omitempty"`
+
+    // The time zone for timestamps, as accepted by time.LoadLocation(), e.g.,
+    // "Local" or "Europe/Paris". Defaults to "UTC".
+    TimeZone string `json:"time_zone,omitempty"`
+
+    // The name of the output format, as accepted by FormatFromString().
+    // Defaults to "text".
+    Format string `json:"format,omitempty"`
+
+    // The policy for messages containing newlines, as accepted by
+    // MultilinePolicyFromString(). Defaults to "raw".
+    Multiline string `json:"multiline,omitempty"`
+
+    // Per-module severity thresholds, keyed by module name or pattern. See
+    // Logger.SetModuleSeverityThresholds().
+    Modules map[string]string `json:"modules,omitempty"`
+
+    // The syslog facility, as accepted by FacilityFromString(). See
+    // Logger.SetFacility().
+    Facility string `json:"facility,omitempty"`
+
+    // How the severity is shown in text output, as accepted by
+    // SeverityLabelFromString(). Defaults to "upper".
+    SeverityLabel string `json:"severity_label,omitempty"`
+}
+
+// A ConfigError is returned when a configuration setting is invalid. Key names
+// the offending setting, either as its JSON key or as its environment
+// variable, depending on where the value came from.
+type ConfigError struct {
+    Key string
+    Value string
+    Err error
+}
+
+func (e *ConfigError) Error() string {
+    return fmt.Sprintf("Invalid value %q for %s: %s", e.Value, e.Key, e.Err)
+}
+
+// Loads a JSON configuration from r. Unknown keys are treated as errors. The
+// returned Config has been validated.
+func LoadConfig(r io.Reader) (*Config, error) {
+    c := new(Config)
+
+    dec := json.NewDecoder(r)
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(c); err != nil {
+        return nil, fmt.Errorf("Couldn't parse log config: %s", err)
+    }
+
+    if err := c.Validate(); err != nil {
+        return nil, err
+    }
+
+    return c, nil
+}
+
+// Loads a JSON configuration from the file at file_path.
+func LoadConfigFile(file_path string) (*Config, error) {
+    fh, err := os.Open(file_path)
+    if err != nil {
+        return nil, err
+    }
+    defer fh.Close()
+
+    return LoadConfig(fh)
+}
+
+// Creates a Config from the GO_LOG_* environment variables. Variables that are
+// not set leave the corresponding setting at its default.
+func ConfigFromEnv() (*Config, error) {
+    c := new(Config)
+    if err := c.ApplyEnv(); err != nil {
+        return nil, err
+    }
+
+    return c, nil
+}
+
+// Overrides settings in c with any GO_LOG_* environment variables that are
+// set, e.g., to let the environment take precedence over a config file. The
+// modules in GO_LOG_MODULES are given as a comma-separated list of
+// module=level pairs, e.g., "db=debug,http_*=info", and are merged into any
+// existing module settings.
+func (c *Config) ApplyEnv() error {
+    if val, ok := os.LookupEnv(EnvOutput); ok {
+        c.Output = val
+    }
+
+    if val, ok := os.LookupEnv(EnvLevel); ok {
+        if err := check_config_level(EnvLevel, val); err != nil {
+            return err
+        }
+        c.Level = val
+    }
+
+    if val, ok := os.LookupEnv(EnvPrefix); ok {
+        c.Prefix = val
+    }
+
+    if val, ok := os.LookupEnv(EnvTimestampFormat); ok {
+        if err := check_config_timestamp(EnvTimestampFormat, val); err != nil {
+            return err
+        }
+        c.TimestampFormat = val
+    }
+
+    if val, ok := os.LookupEnv(EnvTimeZone); ok {
+        if err := check_config_time_zone(EnvTimeZone, val); err != nil {
+            return err
+        }
+        c.TimeZone = val
+    }
+
+    if val, ok := os.LookupEnv(EnvFormat); ok {
+        if err := check_config_format(EnvFormat, val); err != nil {
+            return err
+        }
+        c.Format = val
+    }
+
+    if val, ok := os.LookupEnv(EnvMultiline); ok {
+        if err := check_config_multiline(EnvMultiline, val); err != nil {
+            return err
+        }
+        c.Multiline = val
+    }
+
+    if val, ok := os.LookupEnv(EnvFacility); ok {
+        if err := check_config_facility(EnvFacility, val); err != nil {
+            return err
+        }
+        c.Facility = val
+    }
+
+    if val, ok := os.LookupEnv(EnvSeverityLabel); ok {
+        if err := check_config_label(EnvSeverityLabel, val); err != nil {
+            return err
+        }
+        c.SeverityLabel = val
+    }
+
+    if val, ok := os.LookupEnv(EnvModules); ok {
+        modules, err := parse_env_modules(val)
+        if err != nil {
+            return err
+        }
+        if c.Modules == nil {
+            c.Modules = make(map[string]string, len(modules))
+        }
+        for module, level := range modules {
+            c.Modules[module] = level
+        }
+    }
+
+    return nil
+}
+
+// Checks the configuration for invalid settings. The returned error is a
+// *ConfigError naming the first offending key.
+func (c *Config) Validate() error {
+    if err := check_config_level("level", c.Level); err != nil {
+        return err
+    }
+
+    if err := check_config_format("format", c.Format); err != nil {
+        return err
+    }
+
+    err := check_config_timestamp("timestamp_format", c.TimestampFormat)
+    if err != nil {
+        return err
+    }
+
+    if err := check_config_time_zone("time_zone", c.TimeZone); err != nil {
+        return err
+    }
+
+    if err := check_config_multiline("multiline", c.Multiline); err != nil {
+        return err
+    }
+
+    if err := check_config_facility("facility", c.Facility); err != nil {
+        return err
+    }
+
+    err = check_config_label("severity_label", c.SeverityLabel)
+    if err != nil {
+        return err
+    }
+
+    // Check the modules in order, so that the same error is reported each
+    // time.
+    modules := make([]string, 0, len(c.Modules))
+    for module := range c.Modules {
+        modules = append(modules, module)
+    }
+    sort.Strings(modules)
+    for _, module := range modules {
+        level := c.Modules[module]
+        if module == "" {
+            return &ConfigError{Key: "modules", Value: module,
+                Err: fmt.Errorf("empty module name")}
+        }
+        if err := check_config_level("modules." + module, level); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Creates a logger as described by the configuration c. If c is nil, the
+// default configuration is used.
+func NewFromConfig(c *Config) (*Logger, error) {
+    if c == nil {
+        c = new(Config)
+    }
+    if err := c.Validate(); err != nil {
+        return nil, err
+    }
+
+    sev_thresh := LOG_DEBUG
+    if c.Level != "" {
+        sev_thresh, _ = SeverityFromString(c.Level)
+    }
+
+    var l *Logger
+    switch c.Output {
+    case "", "stderr":
+        l = New(os.Stderr, sev_thresh, c.Prefix)
+    case "stdout":
+        l = New(os.Stdout, sev_thresh, c.Prefix)
+    default:
+        var err error
+        l, err = NewFromFile(c.Output, sev_thresh, c.Prefix)
+        if err != nil {
+            return nil, &ConfigError{Key: "output", Value: c.Output, Err: err}
+        }
+    }
+
+    if c.TimestampFormat != "" {
+        ts_func, _ := config_timestamp_func(c.TimestampFormat)
+        l.SetTimestampFunc(ts_func)
+    }
+
+    if c.TimeZone != "" {
+        loc, _ := time.LoadLocation(c.TimeZone)
+        l.SetTimeLocation(loc)
+    }
+
+    if c.Format != "" {
+        format, _ := FormatFromString(c.Format)
+        l.SetFormat(format)
+    }
+
+    if c.Multiline != "" {
+        policy, _ := MultilinePolicyFromString(c.Multiline)
+        l.SetMultilinePolicy(policy)
+    }
+
+    label := LabelUpper
+    if c.SeverityLabel != "" {
+        label, _ = SeverityLabelFromString(c.SeverityLabel)
+    }
+    l.SetSeverityLabel(label)
+
+    if c.Facility != "" {
+        facility, _ := FacilityFromString(c.Facility)
+        l.SetFacility(facility)
+    }
+
+    if len(c.Modules) > 0 {
+        levels := make(map[string]Severity, len(c.Modules))
+        for module, level := range c.Modules {
+            levels[module], _ = SeverityFromString(level)
+        }
+        l.SetModuleSeverityThresholds(levels)
+    }
+
+    return l, nil
+}
+
+func check_config_level(key, val string) error {
+    if val == "" {
+        return nil
+    }
+    if _, err := SeverityFromString(val); err != nil {
+        return &ConfigError{Key: key, Value: val, Err: err}
+    }
+
+    return nil
+}
+
+// The prefix for time.Format() layouts in the timestamp_format setting.
+const config_layout_prefix = "layout:"
+
+// Returns the timestamp function for a timestamp_format setting, which is nil
+// for "none".
+func config_timestamp_func(val string) (TimestampFunc, error) {
+    if val == "none" {
+        return nil, nil
+    }
+    if strings.HasPrefix(val, config_layout_prefix) {
+        layout := strings.TrimPrefix(val, config_layout_prefix)
+        if layout == "" {
+            return nil, fmt.Errorf("Empty timestamp layout")
+        }
+        return TimestampLayout(layout), nil
+    }
+
+    return TimestampFuncFromString(val)
+}
+
+func check_config_timestamp(key, val string) error {
+    if val == "" {
+        return nil
+    }
+    if _, err := config_timestamp_func(val); err != nil {
+        return &ConfigError{Key: key, Value: val, Err: err}
+    }
+
+    return nil
+}
+
+func check_config_time_zone(key, val string) error {
+    if val == "" {
+        return nil
+    }
+    if _, err := time.LoadLocation(val); err != nil {
+        return &ConfigError{Key: key, Value: val, Err: err}
+    }
+
+    return nil
+}
+
+func check_config_multiline(key, val string) error {
+    if val == "" {
+        return nil
+    }
+    if _, err := MultilinePolicyFromString(val); err != nil {
+        return &ConfigError{Key: key, Value: val, Err: err}
+    }
+
+    return nil
+}
+
+func check_config_facility(key, val string) error {
+    if val == "" {
+        return nil
+    }
+    if _, err := FacilityFromString(val); err != nil {
+        return &ConfigError{Key: key, Value: val, Err: err}
+    }
+
+    return nil
+}
+
+func check_config_label(key, val string) error {
+    if val == "" {
+        return nil
+    }
+    if _, err := SeverityLabelFromString(val); err != nil {
+        return &ConfigError{Key: key, Value: val, Err: err}
+    }
+
+    return nil
+}
+
+func check_config_format(key, val string) error {
+    if val == "" {
+        return nil
+    }
+    if _, err := FormatFromString(val); err != nil {
+        return &ConfigError{Key: key, Value: val, Err: err}
+    }
+
+    return nil
+}
+
+func parse_env_modules(val string) (map[string]string, error) {
+    modules := make(map[string]string)
+
+    for _, item := range strings.Split(val, ",") {
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+
+        eq_idx := strings.Index(item, "=")
+        if eq_idx <= 0 {
+            return nil, &ConfigError{Key: EnvModules, Value: val,
+                Err: fmt.Errorf("expected module=level, got %q", item)}
+        }
+
+        module := strings.TrimSpace(item[:eq_idx])
+        level := strings.TrimSpace(item[eq_idx + 1:])
+        if err := check_config_level(EnvModules, level); err != nil {
+            return nil, err
+        }
+        modules[module] = level
+    }
+
+    return modules, nil
+}
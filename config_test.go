@@ -0,0 +1,164 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    "errors"
+    log "github.com/cuberat/go-log"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestLoadConfig(t *testing.T) {
+    dir, err := ioutil.TempDir("", "go-log-test")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    out_file := filepath.Join(dir, "out.log")
+    conf_json := `{"output": "` + out_file + `", "level": "warning",
+        "prefix": "myapp ", "timestamp_format": "none", "format": "logfmt",
+        "modules": {"config_test": "info"}}`
+
+    conf, err := log.LoadConfig(strings.NewReader(conf_json))
+    if err != nil {
+        t.Fatalf("couldn't load config: %s", err)
+    }
+
+    logger, err := log.NewFromConfig(conf)
+    if err != nil {
+        t.Fatalf("couldn't create logger from config: %s", err)
+    }
+    logger.Info("info msg")
+    logger.Debug("debug msg")
+
+    data, err := ioutil.ReadFile(out_file)
+    if err != nil {
+        t.Fatalf("couldn't read log file: %s", err)
+    }
+    output := string(data)
+
+    expected := `severity=info prefix=myapp source=config_test.go:`
+    if !strings.HasPrefix(output, expected) {
+        t.Errorf("expected output to start with %q, got %q", expected, output)
+    }
+    if !strings.Contains(output, `msg="info msg"`) {
+        t.Errorf("info message from module should be logged: %q", output)
+    }
+    if strings.Contains(output, "debug msg") {
+        t.Errorf("debug message should NOT be logged: %q", output)
+    }
+}
+
+func TestConfigTimestampLayout(t *testing.T) {
+    conf := &log.Config{TimestampFormat: "layout:[2006]",
+        TimeZone: "UTC"}
+    logger, err := log.NewFromConfig(conf)
+    if err != nil {
+        t.Fatalf("couldn't create logger from config: %s", err)
+    }
+    buffer := new(bytes.Buffer)
+    logger.SetOutput(buffer)
+    logger.Info("msg")
+
+    ts := time.Now().UTC().Format("[2006]")
+    if !strings.HasPrefix(buffer.String(), ts + " ") {
+        t.Errorf("expected timestamp %q, got %q", ts, buffer.String())
+    }
+
+    for _, val := range []string{"2006-01-02", "layout:"} {
+        conf := &log.Config{TimestampFormat: val}
+        if err := conf.Validate(); err == nil {
+            t.Errorf("expected an error for timestamp format %q", val)
+        }
+    }
+}
+
+func TestConfigErrors(t *testing.T) {
+    tests := map[string]string{
+        "level": `{"level": "loud"}`,
+        "format": `{"format": "xml"}`,
+        "facility": `{"facility": "local9"}`,
+        "severity_label": `{"severity_label": "fancy"}`,
+        "modules.db": `{"modules": {"db": "verbose"}}`,
+        "modules.a": `{"modules": {"b": "loud", "a": "loud", "c": "loud"}}`,
+        "timestamp_format": `{"timestamp_format": "rfc3339mili"}`,
+    }
+
+    for key, conf_json := range tests {
+        _, err := log.LoadConfig(strings.NewReader(conf_json))
+        var conf_err *log.ConfigError
+        if !errors.As(err, &conf_err) {
+            t.Errorf("expected a ConfigError for %s, got %v", conf_json, err)
+            continue
+        }
+        if conf_err.Key != key {
+            t.Errorf("expected error for key %q, got %q", key, conf_err.Key)
+        }
+    }
+
+    _, err := log.LoadConfig(strings.NewReader(`{"colour": "blue"}`))
+    if err == nil || !strings.Contains(err.Error(), "colour") {
+        t.Errorf("expected error naming unknown key \"colour\", got %v", err)
+    }
+}
+
+func TestConfigFromEnv(t *testing.T) {
+    env := map[string]string{
+        log.EnvLevel: "err",
+        log.EnvFormat: "json",
+        log.EnvModules: "db=debug, http_*=info",
+    }
+    for key, val := range env {
+        os.Setenv(key, val)
+        defer os.Unsetenv(key)
+    }
+
+    conf, err := log.ConfigFromEnv()
+    if err != nil {
+        t.Fatalf("couldn't load config from environment: %s", err)
+    }
+    if conf.Level != "err" || conf.Format != "json" {
+        t.Errorf("unexpected config from environment: %+v", conf)
+    }
+    if conf.Modules["db"] != "debug" || conf.Modules["http_*"] != "info" {
+        t.Errorf("unexpected modules from environment: %v", conf.Modules)
+    }
+
+    os.Setenv(log.EnvLevel, "loud")
+    _, err = log.ConfigFromEnv()
+    var conf_err *log.ConfigError
+    if !errors.As(err, &conf_err) || conf_err.Key != log.EnvLevel {
+        t.Errorf("expected a ConfigError for %s, got %v", log.EnvLevel, err)
+    }
+}
@@ -0,0 +1,109 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "io"
+    "os"
+    "sync"
+)
+
+// Exit settings and hooks shared by a logger and its descendants.
+type exit_state struct {
+    lock sync.Mutex
+    code int
+    hooks []func()
+    closer io.Closer
+}
+
+// Sets the function called by the Fatal family of methods, and by Recover()
+// with RecoverExit, to end the program. The default is os.Exit. Tests can
+// replace it to check code paths that call Fatal(). If the function returns,
+// so does the Fatal call, and the logger remains usable. Passing nil restores
+// os.Exit.
+func (l *Logger) SetExitFunc(f func(code int)) {
+    l.core.exit_func = f
+}
+
+// Sets the exit code passed to the exit function. The default is 1.
+func (l *Logger) SetExitCode(code int) {
+    l.core.exit.lock.Lock()
+    defer l.core.exit.lock.Unlock()
+
+    l.core.exit.code = code
+}
+
+// Registers a function to be called before the logger's exit function, e.g.,
+// to shut down servers or remove temporary files. Hooks are run in the reverse
+// order of registration, as deferred calls are, and may log messages.
+func (l *Logger) OnExit(f func()) {
+    l.core.exit.lock.Lock()
+    defer l.core.exit.lock.Unlock()
+
+    l.core.exit.hooks = append(l.core.exit.hooks, f)
+}
+
+// Runs the exit hooks, flushes the Writer if it has a Flush method, and then
+// calls the exit function. The file opened by NewFromFile(), if any, is only
+// closed right before calling os.Exit, since a replacement exit function may
+// return and the logger may then be used again.
+func (l *Logger) exit() {
+    es := l.core.exit
+    es.lock.Lock()
+    code := es.code
+    hooks := es.hooks
+    es.hooks = nil
+    es.lock.Unlock()
+
+    for i := len(hooks) - 1; i >= 0; i-- {
+        hooks[i]()
+    }
+
+    l.get_lock()
+    if flusher, ok := l.core.writer.(interface{ Flush() error }); ok {
+        flusher.Flush()
+    }
+    exit_func := l.core.exit_func
+    if exit_func == nil {
+        if es.closer != nil {
+            es.closer.Close()
+            es.closer = nil
+        }
+        exit_func = os.Exit
+    }
+    l.release_lock()
+
+    exit_func(code)
+}
+
+// Logs a message with the given severity regardless of the severity
+// threshold, as is done for the Fatal and Panic families of methods.
+func (l *Logger) log_always(call_depth int, sev Severity, m string) error {
+    l.flush_recent(sev)
+
+    return l.emit(call_depth + 1, sev, m)
+}
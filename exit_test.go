@@ -0,0 +1,202 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    "fmt"
+    log "github.com/cuberat/go-log"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// Syslog-like writer that records which method each message was sent with.
+type MethodRecorder struct {
+    Lines []string
+}
+
+func (r *MethodRecorder) record(method, m string) error {
+    r.Lines = append(r.Lines, method + ": " + strings.TrimSuffix(m, "\n"))
+    return nil
+}
+
+func (r *MethodRecorder) Alert(m string) error {
+    return r.record("alert", m)
+}
+
+func (r *MethodRecorder) Crit(m string) error {
+    return r.record("crit", m)
+}
+
+func (r *MethodRecorder) Debug(m string) error {
+    return r.record("debug", m)
+}
+
+func (r *MethodRecorder) Emerg(m string) error {
+    return r.record("emerg", m)
+}
+
+func (r *MethodRecorder) Err(m string) error {
+    return r.record("err", m)
+}
+
+func (r *MethodRecorder) Info(m string) error {
+    return r.record("info", m)
+}
+
+func (r *MethodRecorder) Notice(m string) error {
+    return r.record("notice", m)
+}
+
+func (r *MethodRecorder) Warning(m string) error {
+    return r.record("warning", m)
+}
+
+func (r *MethodRecorder) Write(b []byte) (int, error) {
+    return len(b), r.record("write", string(b))
+}
+
+type FlushBuffer struct {
+    bytes.Buffer
+    Flushed bool
+}
+
+func (b *FlushBuffer) Flush() error {
+    b.Flushed = true
+    return nil
+}
+
+func TestFatal(t *testing.T) {
+    buffer := new(FlushBuffer)
+    logger := log.New(buffer, log.LOG_EMERG, "p: ")
+    logger.SetFormat(log.FormatLogfmt)
+    logger.SetExitCode(3)
+
+    exit_code := -1
+    logger.SetExitFunc(func(code int) {
+        exit_code = code
+    })
+
+    var hooks []string
+    logger.OnExit(func() { hooks = append(hooks, "first") })
+    logger.OnExit(func() {
+        hooks = append(hooks, "second")
+        logger.Print("shutting down")
+    })
+
+    logger.Named("child").Fatalf("can't %s", "continue")
+
+    if exit_code != 3 {
+        t.Errorf("exit function called with %d, expected 3", exit_code)
+    }
+    if fmt.Sprint(hooks) != "[second first]" {
+        t.Errorf("hooks ran as %v, expected [second first]", hooks)
+    }
+    if !buffer.Flushed {
+        t.Errorf("writer wasn't flushed")
+    }
+
+    output := buffer.String()
+    if !strings.Contains(output, "severity=crit ") ||
+        !strings.Contains(output, `msg="can't continue"`) ||
+        !strings.Contains(output, "source=exit_test.go:") {
+        t.Errorf("unexpected output %q", output)
+    }
+    if !strings.Contains(output, "shutting down") {
+        t.Errorf("message from exit hook missing: %q", output)
+    }
+}
+
+func TestFatalFromFileNoExit(t *testing.T) {
+    dir, err := ioutil.TempDir("", "exit_test")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+    defer os.RemoveAll(dir)
+    file_path := filepath.Join(dir, "app.log")
+
+    logger, err := log.NewFromFile(file_path, log.LOG_DEBUG, "p: ")
+    if err != nil {
+        t.Fatalf("couldn't open log file: %s", err)
+    }
+    logger.SetExitFunc(func(code int) {})
+
+    logger.Fatal("first")
+    logger.Fatal("second")
+    if err := logger.Info("after"); err != nil {
+        t.Errorf("logging after Fatal failed: %s", err)
+    }
+
+    data, err := ioutil.ReadFile(file_path)
+    if err != nil {
+        t.Fatalf("couldn't read log file: %s", err)
+    }
+    if !strings.Contains(string(data), ": second\n") ||
+        !strings.HasSuffix(string(data), ": after\n") {
+        t.Errorf("unexpected log file contents %q", data)
+    }
+}
+
+func TestFatalPanicSyslog(t *testing.T) {
+    recorder := new(MethodRecorder)
+    logger := log.New(recorder, log.LOG_EMERG, "p: ")
+    logger.SetExitFunc(func(code int) {})
+
+    logger.Fatal("fatal")
+    func() {
+        defer func() {
+            if r := recover(); r != "panic" {
+                t.Errorf("recovered %v, expected \"panic\"", r)
+            }
+        }()
+        logger.Panic("panic")
+    }()
+
+    if len(recorder.Lines) != 2 ||
+        !strings.HasPrefix(recorder.Lines[0], "crit: ") ||
+        !strings.HasSuffix(recorder.Lines[0], ": fatal") ||
+        !strings.HasPrefix(recorder.Lines[1], "emerg: ") ||
+        !strings.HasSuffix(recorder.Lines[1], ": panic") {
+        t.Errorf("unexpected syslog calls %q", recorder.Lines)
+    }
+}
+
+func TestRecoverExit(t *testing.T) {
+    logger := log.New(new(bytes.Buffer), log.LOG_DEBUG, "p: ")
+    exit_code := -1
+    logger.SetExitFunc(func(code int) {
+        exit_code = code
+    })
+
+    panicky(logger, log.RecoverThen(log.RecoverExit))
+    if exit_code != 1 {
+        t.Errorf("exit function called with %d, expected 1", exit_code)
+    }
+}
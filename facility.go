@@ -0,0 +1,183 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// The Facility type. Facilities have the same values as in log/syslog, i.e.,
+// they are already shifted into place for combining with a Severity.
+type Facility int
+
+// Facilities to be passed to SetFacility() or NewSyslogWriter().
+const (
+    LOG_KERN Facility = iota << 3
+    LOG_USER
+    LOG_MAIL
+    LOG_DAEMON
+    LOG_AUTH
+    LOG_SYSLOG
+    LOG_LPR
+    LOG_NEWS
+    LOG_UUCP
+    LOG_CRON
+    LOG_AUTHPRIV
+    LOG_FTP
+    _ // unused
+    _ // unused
+    _ // unused
+    _ // unused
+    LOG_LOCAL0
+    LOG_LOCAL1
+    LOG_LOCAL2
+    LOG_LOCAL3
+    LOG_LOCAL4
+    LOG_LOCAL5
+    LOG_LOCAL6
+    LOG_LOCAL7
+)
+
+// A Priority is a syslog priority value, combining a Facility and a Severity,
+// as sent in the "<PRI>" part of a syslog message.
+type Priority int
+
+var facility_names = map[Facility]string{
+    LOG_KERN: "kern",
+    LOG_USER: "user",
+    LOG_MAIL: "mail",
+    LOG_DAEMON: "daemon",
+    LOG_AUTH: "auth",
+    LOG_SYSLOG: "syslog",
+    LOG_LPR: "lpr",
+    LOG_NEWS: "news",
+    LOG_UUCP: "uucp",
+    LOG_CRON: "cron",
+    LOG_AUTHPRIV: "authpriv",
+    LOG_FTP: "ftp",
+    LOG_LOCAL0: "local0",
+    LOG_LOCAL1: "local1",
+    LOG_LOCAL2: "local2",
+    LOG_LOCAL3: "local3",
+    LOG_LOCAL4: "local4",
+    LOG_LOCAL5: "local5",
+    LOG_LOCAL6: "local6",
+    LOG_LOCAL7: "local7",
+}
+
+// Converts a facility name, such as "local6" or "LOG_DAEMON", to a Facility.
+// The obsolete name "security" is accepted for "auth".
+func FacilityFromString(facility_string string) (Facility, error) {
+    check_facility := strings.TrimPrefix(strings.ToLower(facility_string),
+        "log_")
+    if check_facility == "security" {
+        return LOG_AUTH, nil
+    }
+    for facility, name := range facility_names {
+        if name == check_facility {
+            return facility, nil
+        }
+    }
+
+    return Facility(0), fmt.Errorf("Unknown facility %q", facility_string)
+}
+
+// Returns the name of the facility, as accepted by FacilityFromString().
+func (f Facility) String() string {
+    if name, ok := facility_names[f]; ok {
+        return name
+    }
+
+    return fmt.Sprintf("Facility(%d)", int(f))
+}
+
+// Combines a facility and a severity into a priority.
+func MakePriority(f Facility, sev Severity) Priority {
+    return Priority(int(f & 0x3f8) | int(sev & 0x07))
+}
+
+// Returns the facility part of the priority.
+func (p Priority) Facility() Facility {
+    return Facility(p & 0x3f8)
+}
+
+// Returns the severity part of the priority.
+func (p Priority) Severity() Severity {
+    return Severity(p & 0x07)
+}
+
+// Returns the priority as "facility.severity", e.g., "local6.info", as
+// accepted by PriorityFromString().
+func (p Priority) String() string {
+    return p.Facility().String() + "." + p.Severity().name()
+}
+
+// Converts a priority in "facility.severity" form, as used in syslog.conf,
+// e.g., "local6.info", or a numeric priority, e.g., "182" or "<182>", to a
+// Priority.
+func PriorityFromString(pri_string string) (Priority, error) {
+    s := strings.TrimSuffix(strings.TrimPrefix(pri_string, "<"), ">")
+    if n, err := strconv.Atoi(s); err == nil {
+        if n < 0 || n > int(LOG_LOCAL7) + int(LOG_DEBUG) {
+            return Priority(0), fmt.Errorf("Priority %q out of range",
+                pri_string)
+        }
+        return Priority(n), nil
+    }
+
+    dot_idx := strings.LastIndex(pri_string, ".")
+    if dot_idx < 0 {
+        return Priority(0), fmt.Errorf("Invalid priority %q", pri_string)
+    }
+    facility, err := FacilityFromString(pri_string[:dot_idx])
+    if err != nil {
+        return Priority(0), err
+    }
+    sev, err := SeverityFromString(pri_string[dot_idx + 1:])
+    if err != nil {
+        return Priority(0), err
+    }
+
+    return MakePriority(facility, sev), nil
+}
+
+// Sets the syslog facility attached to each record logged, which is passed on
+// by writers that support it, such as SyslogWriter and JournalWriter. Writers
+// that implement only SyslogLike, such as a log/syslog Writer, use the
+// facility they were created with. LOG_KERN, the zero value, is reserved for
+// the kernel and means that no facility is set, leaving the choice to the
+// writer.
+func (l *Logger) SetFacility(f Facility) {
+    l.core.facility = f
+}
+
+// Returns the facility set with SetFacility(), or LOG_KERN if none was set.
+func (l *Logger) Facility() Facility {
+    return l.core.facility
+}
@@ -0,0 +1,108 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    log "github.com/cuberat/go-log"
+    "testing"
+)
+
+type FacilityTest struct {
+    Name string
+    Facility log.Facility
+}
+
+func TestFacilityFromString(t *testing.T) {
+    tests := []*FacilityTest{
+        &FacilityTest{"local6", log.LOG_LOCAL6},
+        &FacilityTest{"LOG_DAEMON", log.LOG_DAEMON},
+        &FacilityTest{"AuthPriv", log.LOG_AUTHPRIV},
+        &FacilityTest{"security", log.LOG_AUTH},
+    }
+
+    for _, tester := range tests {
+        t.Run(tester.Name, func(t *testing.T) {
+            f, err := log.FacilityFromString(tester.Name)
+            if err != nil {
+                t.Fatalf("couldn't parse facility: %s", err)
+            }
+            if f != tester.Facility {
+                t.Errorf("got %s, expected %s", f, tester.Facility)
+            }
+        })
+    }
+
+    if _, err := log.FacilityFromString("local8"); err == nil {
+        t.Errorf("expected an error for an unknown facility")
+    }
+}
+
+type PriorityTest struct {
+    Input string
+    Priority log.Priority
+    String string
+}
+
+func TestPriority(t *testing.T) {
+    pri := log.MakePriority(log.LOG_LOCAL6, log.LOG_INFO)
+    if int(pri) != 182 {
+        t.Errorf("got priority %d, expected 182", int(pri))
+    }
+    if pri.Facility() != log.LOG_LOCAL6 || pri.Severity() != log.LOG_INFO {
+        t.Errorf("priority %d decoded as %s/%d", int(pri), pri.Facility(),
+            int(pri.Severity()))
+    }
+
+    tests := []*PriorityTest{
+        &PriorityTest{"local6.info", 182, "local6.info"},
+        &PriorityTest{"mail.warn", 20, "mail.warning"},
+        &PriorityTest{"<86>", 86, "authpriv.info"},
+        &PriorityTest{"0", 0, "kern.emerg"},
+    }
+
+    for _, tester := range tests {
+        t.Run(tester.Input, func(t *testing.T) {
+            p, err := log.PriorityFromString(tester.Input)
+            if err != nil {
+                t.Fatalf("couldn't parse priority: %s", err)
+            }
+            if p != tester.Priority {
+                t.Errorf("got %d, expected %d", int(p), int(tester.Priority))
+            }
+            if p.String() != tester.String {
+                t.Errorf("got string %q, expected %q", p.String(),
+                    tester.String)
+            }
+        })
+    }
+
+    for _, bad := range []string{"local6", "local6.loud", "192", "-1"} {
+        if _, err := log.PriorityFromString(bad); err == nil {
+            t.Errorf("expected an error for %q", bad)
+        }
+    }
+}
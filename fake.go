@@ -0,0 +1,394 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "fmt"
+    "runtime"
+    "strings"
+    "sync"
+    "time"
+)
+
+// A NopLogger implements SeverityLogger and StdLogger by discarding all
+// messages. The Fatal methods do nothing and return, so that code under test
+// that reaches a Fatal call doesn't end the test binary; use a RecordingLogger
+// to check whether it did. The Panic methods still panic, as the panic can be
+// recovered.
+type NopLogger struct{}
+
+// Discards the message.
+func (NopLogger) Alert(m string) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Alertf(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Crit(m string) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Critf(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Debug(m string) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Debugf(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Emerg(m string) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Emergf(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Err(m string) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Errf(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Info(m string) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Infof(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Notice(m string) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Noticef(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Warning(m string) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Warningf(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Print(v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Printf(format string, v ...interface{}) error {
+    return nil
+}
+
+// Discards the message.
+func (NopLogger) Println(v ...interface{}) error {
+    return nil
+}
+
+// Discards the message and returns without exiting.
+func (NopLogger) Fatal(v ...interface{}) {
+}
+
+// Discards the message and returns without exiting.
+func (NopLogger) Fatalf(format string, v ...interface{}) {
+}
+
+// Discards the message and returns without exiting.
+func (NopLogger) Fatalln(v ...interface{}) {
+}
+
+// Discards the message and panics.
+func (NopLogger) Panic(v ...interface{}) {
+    panic(fmt.Sprint(v...))
+}
+
+// Discards the message and panics.
+func (NopLogger) Panicf(format string, v ...interface{}) {
+    panic(fmt.Sprintf(format, v...))
+}
+
+// Discards the message and panics.
+func (NopLogger) Panicln(v ...interface{}) {
+    panic(fmt.Sprintln(v...))
+}
+
+// A RecordingLogger implements SeverityLogger and StdLogger by keeping every
+// message as a Record, for checking what code under test logged. Messages are
+// recorded regardless of severity. As with Logger, the Fatal methods record
+// their message with severity LOG_CRIT and the Panic methods with LOG_EMERG.
+// The Panic methods then panic, but the Fatal methods only mark the logger as
+// exited (see Exited()) and return, so that tests can continue. A
+// RecordingLogger can be used simultaneously from multiple goroutines.
+type RecordingLogger struct {
+    lock sync.Mutex
+    records []*Record
+    exited bool
+}
+
+// Creates an empty RecordingLogger.
+func NewRecordingLogger() *RecordingLogger {
+    return new(RecordingLogger)
+}
+
+// Returns the records logged so far, oldest first.
+func (r *RecordingLogger) Records() []*Record {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    records := make([]*Record, len(r.records))
+    copy(records, r.records)
+
+    return records
+}
+
+// Returns the messages logged so far, oldest first.
+func (r *RecordingLogger) Messages() []string {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    msgs := make([]string, len(r.records))
+    for i, rec := range r.records {
+        msgs[i] = rec.Message
+    }
+
+    return msgs
+}
+
+// Reports whether one of the Fatal methods has been called.
+func (r *RecordingLogger) Exited() bool {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    return r.exited
+}
+
+// Discards the records and clears the exited flag.
+func (r *RecordingLogger) Reset() {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    r.records = nil
+    r.exited = false
+}
+
+// Records a message for the function call_depth frames above the caller.
+func (r *RecordingLogger) record(call_depth int, sev Severity,
+    m string) error {
+
+    rec := &Record{Time: time.Now(), Severity: sev,
+        Message: strings.TrimSuffix(m, "\n")}
+    pc, file_name, line, ok := runtime.Caller(call_depth + 1)
+    if ok {
+        rec.File = file_name
+        rec.Line = line
+        if fn := runtime.FuncForPC(pc); fn != nil {
+            rec.Func = fn.Name()
+        }
+    }
+
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    r.records = append(r.records, rec)
+
+    return nil
+}
+
+func (r *RecordingLogger) fatal(m string) {
+    r.record(2, LOG_CRIT, m)
+
+    r.lock.Lock()
+    defer r.lock.Unlock()
+
+    r.exited = true
+}
+
+// Records a message with severity LOG_ALERT.
+func (r *RecordingLogger) Alert(m string) error {
+    return r.record(1, LOG_ALERT, m)
+}
+
+// Records a message with severity LOG_ALERT. Arguments are handled in the
+// manner of fmt.Printf.
+func (r *RecordingLogger) Alertf(format string, v ...interface{}) error {
+    return r.record(1, LOG_ALERT, sprintf(format, v...))
+}
+
+// Records a message with severity LOG_CRIT.
+func (r *RecordingLogger) Crit(m string) error {
+    return r.record(1, LOG_CRIT, m)
+}
+
+// Records a message with severity LOG_CRIT. Arguments are handled in the
+// manner of fmt.Printf.
+func (r *RecordingLogger) Critf(format string, v ...interface{}) error {
+    return r.record(1, LOG_CRIT, sprintf(format, v...))
+}
+
+// Records a message with severity LOG_DEBUG.
+func (r *RecordingLogger) Debug(m string) error {
+    return r.record(1, LOG_DEBUG, m)
+}
+
+// Records a message with severity LOG_DEBUG. Arguments are handled in the
+// manner of fmt.Printf.
+func (r *RecordingLogger) Debugf(format string, v ...interface{}) error {
+    return r.record(1, LOG_DEBUG, sprintf(format, v...))
+}
+
+// Records a message with severity LOG_EMERG.
+func (r *RecordingLogger) Emerg(m string) error {
+    return r.record(1, LOG_EMERG, m)
+}
+
+// Records a message with severity LOG_EMERG. Arguments are handled in the
+// manner of fmt.Printf.
+func (r *RecordingLogger) Emergf(format string, v ...interface{}) error {
+    return r.record(1, LOG_EMERG, sprintf(format, v...))
+}
+
+// Records a message with severity LOG_ERR.
+func (r *RecordingLogger) Err(m string) error {
+    return r.record(1, LOG_ERR, m)
+}
+
+// Records a message with severity LOG_ERR. Arguments are handled in the
+// manner of fmt.Printf.
+func (r *RecordingLogger) Errf(format string, v ...interface{}) error {
+    return r.record(1, LOG_ERR, sprintf(format, v...))
+}
+
+// Records a message with severity LOG_INFO.
+func (r *RecordingLogger) Info(m string) error {
+    return r.record(1, LOG_INFO, m)
+}
+
+// Records a message with severity LOG_INFO. Arguments are handled in the
+// manner of fmt.Printf.
+func (r *RecordingLogger) Infof(format string, v ...interface{}) error {
+    return r.record(1, LOG_INFO, sprintf(format, v...))
+}
+
+// Records a message with severity LOG_NOTICE.
+func (r *RecordingLogger) Notice(m string) error {
+    return r.record(1, LOG_NOTICE, m)
+}
+
+// Records a message with severity LOG_NOTICE. Arguments are handled in the
+// manner of fmt.Printf.
+func (r *RecordingLogger) Noticef(format string, v ...interface{}) error {
+    return r.record(1, LOG_NOTICE, sprintf(format, v...))
+}
+
+// Records a message with severity LOG_WARNING.
+func (r *RecordingLogger) Warning(m string) error {
+    return r.record(1, LOG_WARNING, m)
+}
+
+// Records a message with severity LOG_WARNING. Arguments are handled in the
+// manner of fmt.Printf.
+func (r *RecordingLogger) Warningf(format string, v ...interface{}) error {
+    return r.record(1, LOG_WARNING, sprintf(format, v...))
+}
+
+// Records a message without a severity. Arguments are handled in the manner
+// of fmt.Print.
+func (r *RecordingLogger) Print(v ...interface{}) error {
+    return r.record(1, sev_none, sprint(v...))
+}
+
+// Records a message without a severity. Arguments are handled in the manner
+// of fmt.Printf.
+func (r *RecordingLogger) Printf(format string, v ...interface{}) error {
+    return r.record(1, sev_none, sprintf(format, v...))
+}
+
+// Records a message without a severity. Arguments are handled in the manner
+// of fmt.Println.
+func (r *RecordingLogger) Println(v ...interface{}) error {
+    return r.record(1, sev_none, sprintln(v...))
+}
+
+// Records a message with severity LOG_CRIT and marks the logger as exited.
+func (r *RecordingLogger) Fatal(v ...interface{}) {
+    r.fatal(sprint(v...))
+}
+
+// Records a message with severity LOG_CRIT and marks the logger as exited.
+func (r *RecordingLogger) Fatalf(format string, v ...interface{}) {
+    r.fatal(sprintf(format, v...))
+}
+
+// Records a message with severity LOG_CRIT and marks the logger as exited.
+func (r *RecordingLogger) Fatalln(v ...interface{}) {
+    r.fatal(sprintln(v...))
+}
+
+// Records a message with severity LOG_EMERG and panics.
+func (r *RecordingLogger) Panic(v ...interface{}) {
+    r.record(1, LOG_EMERG, sprint(v...))
+    panic(fmt.Sprint(v...))
+}
+
+// Records a message with severity LOG_EMERG and panics.
+func (r *RecordingLogger) Panicf(format string, v ...interface{}) {
+    r.record(1, LOG_EMERG, sprintf(format, v...))
+    panic(fmt.Sprintf(format, v...))
+}
+
+// Records a message with severity LOG_EMERG and panics.
+func (r *RecordingLogger) Panicln(v ...interface{}) {
+    r.record(1, LOG_EMERG, sprintln(v...))
+    panic(fmt.Sprintln(v...))
+}
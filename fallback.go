@@ -0,0 +1,232 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "runtime"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// An ErrorHandler is called when a message can't be written to the Writer,
+// with the error and the record that wasn't written. It is called after the
+// logger's lock has been released, so it may log to the same logger. Messages
+// that the handler logs itself, on the goroutine it was called on, go only to
+// the fallback writer if they fail, without calling the handler again, so
+// that a broken Writer can't make the handler recurse. Failures on other
+// goroutines still call the handler, so it may run concurrently.
+type ErrorHandler func(err error, rec *Record)
+
+// ErrWriterUnavailable is returned, and passed to the ErrorHandler, for
+// messages that were not written because the circuit breaker is open. See
+// SetCircuitBreaker().
+var ErrWriterUnavailable = fmt.Errorf("Log writer disabled after repeated " +
+    "write errors")
+
+// The error policy and state of the Writer, shared by a logger and its
+// descendants. Guarded by the logger's lock.
+type write_guard struct {
+    handler ErrorHandler
+    fallback io.Writer
+
+    // The goroutines on which the handler is running. Guarded by
+    // handler_lock, as the handler is called without the logger's lock.
+    handler_lock sync.Mutex
+    in_handler map[uint64]bool
+
+    max_failures int
+    retry time.Duration
+
+    // Consecutive failed writes, and when to try again once max_failures is
+    // reached.
+    failures int
+    retry_at time.Time
+
+    // Messages not written to the Writer since it last failed, and how many of
+    // those were also not written to the fallback writer.
+    missed uint64
+    lost uint64
+}
+
+// Sets a function to be called when a message can't be written to the Writer.
+// Passing nil removes the handler.
+func (l *Logger) SetErrorHandler(h ErrorHandler) {
+    l.get_lock()
+    defer l.release_lock()
+
+    l.core.guard.handler = h
+}
+
+// Sets a writer, e.g., os.Stderr, that receives messages formatted as text
+// lines when they can't be written to the Writer. Logging methods return nil
+// for messages written to the fallback writer. Messages that can't be written
+// to either are counted as lost in Stats(). Passing nil removes the fallback
+// writer.
+func (l *Logger) SetFallbackWriter(w io.Writer) {
+    l.get_lock()
+    defer l.release_lock()
+
+    l.core.guard.fallback = w
+}
+
+// Turns on the circuit breaker: after max_failures consecutive failed writes,
+// the logger stops writing to the Writer, and messages go to the fallback
+// writer, if any, or are lost. After retry, the next message is tried on the
+// Writer again. Once a write succeeds, the logger writes a warning reporting
+// how many messages were not written while it was failing. Passing a
+// max_failures of zero or less turns off the circuit breaker, which is the
+// default.
+func (l *Logger) SetCircuitBreaker(max_failures int, retry time.Duration) {
+    l.get_lock()
+    defer l.release_lock()
+
+    g := &l.core.guard
+    g.max_failures = max_failures
+    g.retry = retry
+    g.failures = 0
+    g.retry_at = time.Time{}
+}
+
+// Calls the error handler, if there is one and it isn't already running on
+// this goroutine, i.e., the failed message wasn't logged by the handler.
+func (g *write_guard) call_handler(handler ErrorHandler, err error,
+    rec *Record) {
+
+    if handler == nil {
+        return
+    }
+
+    id := goroutine_id()
+    g.handler_lock.Lock()
+    if g.in_handler[id] {
+        g.handler_lock.Unlock()
+        return
+    }
+    if g.in_handler == nil {
+        g.in_handler = make(map[uint64]bool)
+    }
+    g.in_handler[id] = true
+    g.handler_lock.Unlock()
+
+    defer func() {
+        g.handler_lock.Lock()
+        delete(g.in_handler, id)
+        g.handler_lock.Unlock()
+    }()
+
+    handler(err, rec)
+}
+
+// Returns the ID of the current goroutine, from the "goroutine N [...]" line
+// at the start of its stack trace. Go has no other way to tell goroutines
+// apart; this is only called after a failed write.
+func goroutine_id() uint64 {
+    buf := make([]byte, 64)
+    buf = buf[:runtime.Stack(buf, false)]
+    buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+    if idx := bytes.IndexByte(buf, ' '); idx >= 0 {
+        buf = buf[:idx]
+    }
+    id, _ := strconv.ParseUint(string(buf), 10, 64)
+
+    return id
+}
+
+// Reports whether the Writer should be skipped because the circuit breaker is
+// open.
+func (g *write_guard) is_open() bool {
+    return g.max_failures > 0 && g.failures >= g.max_failures &&
+        time.Now().Before(g.retry_at)
+}
+
+// Records the result of a write to the Writer. Returns the number of messages
+// missed, and lost, since the Writer started failing, if this write was the
+// first success since then.
+func (g *write_guard) record_result(err error) (uint64, uint64) {
+    if err != nil {
+        g.failures++
+        if g.max_failures > 0 && g.failures >= g.max_failures {
+            g.retry_at = time.Now().Add(g.retry)
+        }
+        return 0, 0
+    }
+
+    g.failures = 0
+    missed, lost := g.missed, g.lost
+    g.missed = 0
+    g.lost = 0
+
+    return missed, lost
+}
+
+// Handles a message that couldn't be written to the Writer, writing it to the
+// fallback writer, if any. The line is the formatted message, or empty if it
+// has not been formatted as text. Reports whether the fallback write
+// succeeded.
+func (l *Logger) write_fallback(rec *Record, line []byte) bool {
+    g := &l.core.guard
+    g.missed++
+
+    if g.fallback != nil {
+        if len(line) == 0 {
+            b := get_buffer()
+            defer put_buffer(b)
+            l.write_formatted(b, rec, 0)
+            line = b.Bytes()
+        }
+        if _, err := g.fallback.Write(line); err == nil {
+            return true
+        }
+    }
+
+    g.lost++
+    l.core.stats.count_lost()
+
+    return false
+}
+
+// Logs a warning that the Writer has recovered, after missing messages.
+func (l *Logger) report_recovery(rec *Record, missed, lost uint64) {
+    note := &Record{
+        Time: time.Now().In(l.core.ts_location),
+        Severity: LOG_WARNING,
+        Facility: l.core.facility,
+        Prefix: l.core.prefix,
+        File: rec.File,
+        Line: rec.Line,
+        Func: rec.Func,
+        Message: fmt.Sprintf("Log writer recovered: %d messages were not " +
+            "written to it, %d of them lost", missed, lost),
+        caller: rec.caller,
+    }
+    l.core.stats.count_emitted(LOG_WARNING)
+    l.emit_record(note)
+}
@@ -0,0 +1,180 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    "errors"
+    log "github.com/cuberat/go-log"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// A writer that fails while Broken is set.
+type FlakyWriter struct {
+    bytes.Buffer
+    Broken bool
+    Attempts int
+}
+
+func (w *FlakyWriter) Write(b []byte) (int, error) {
+    w.Attempts++
+    if w.Broken {
+        return 0, errors.New("disk full")
+    }
+
+    return w.Buffer.Write(b)
+}
+
+func TestFallbackWriter(t *testing.T) {
+    primary := new(FlakyWriter)
+    fallback := new(bytes.Buffer)
+    logger := log.New(primary, log.LOG_DEBUG, "p: ")
+    logger.SetTimestampFunc(nil)
+    logger.SetFallbackWriter(fallback)
+
+    var handled []string
+    logger.SetErrorHandler(func(err error, rec *log.Record) {
+        handled = append(handled, err.Error() + ": " + rec.Message)
+    })
+
+    primary.Broken = true
+    if err := logger.Err("one"); err != nil {
+        t.Errorf("expected no error with a fallback writer, got %s", err)
+    }
+    logger.SetFallbackWriter(new(FailingWriter))
+    if err := logger.Err("two"); err == nil {
+        t.Errorf("expected an error when both writers fail")
+    }
+    if !strings.HasSuffix(fallback.String(), ": one\n") {
+        t.Errorf("unexpected fallback output %q", fallback.String())
+    }
+    if len(handled) != 2 || handled[0] != "disk full: one" {
+        t.Errorf("unexpected handler calls %q", handled)
+    }
+    if logger.Stats().Lost != 1 {
+        t.Errorf("lost %d messages, expected 1", logger.Stats().Lost)
+    }
+
+    primary.Broken = false
+    logger.Err("three")
+    lines := strings.Split(strings.TrimSpace(primary.String()), "\n")
+    if len(lines) != 2 || !strings.HasSuffix(lines[0], ": three") ||
+        !strings.HasSuffix(lines[1],
+            ": Log writer recovered: 2 messages were not written to it, " +
+            "1 of them lost") {
+        t.Errorf("unexpected output %q", primary.String())
+    }
+}
+
+func TestCircuitBreaker(t *testing.T) {
+    primary := &FlakyWriter{Broken: true}
+    logger := log.New(primary, log.LOG_DEBUG, "p: ")
+    logger.SetCircuitBreaker(2, 50 * time.Millisecond)
+
+    for i := 0; i < 5; i++ {
+        logger.Info("lost")
+    }
+    if primary.Attempts != 2 {
+        t.Errorf("made %d write attempts, expected 2", primary.Attempts)
+    }
+    if err := logger.Info("skipped"); err != log.ErrWriterUnavailable {
+        t.Errorf("expected ErrWriterUnavailable, got %v", err)
+    }
+
+    // Once the retry interval has passed, the next message is tried again.
+    time.Sleep(100 * time.Millisecond)
+    primary.Broken = false
+    if err := logger.Info("back"); err != nil {
+        t.Errorf("write after retry failed: %s", err)
+    }
+    if !strings.Contains(primary.String(), "6 messages were not written") {
+        t.Errorf("recovery not reported: %q", primary.String())
+    }
+}
+
+func TestErrorHandlerLogs(t *testing.T) {
+    primary := &FlakyWriter{Broken: true}
+    fallback := new(bytes.Buffer)
+    logger := log.New(primary, log.LOG_DEBUG, "p: ")
+    logger.SetFallbackWriter(fallback)
+
+    calls := 0
+    logger.SetErrorHandler(func(err error, rec *log.Record) {
+        calls++
+        logger.Errf("couldn't log %q: %s", rec.Message, err)
+    })
+
+    logger.Info("one")
+    if calls != 1 {
+        t.Errorf("handler called %d times, expected 1", calls)
+    }
+    if !strings.HasSuffix(fallback.String(),
+        `: couldn't log "one": disk full` + "\n") {
+        t.Errorf("unexpected fallback output %q", fallback.String())
+    }
+
+    logger.Info("two")
+    if calls != 2 {
+        t.Errorf("handler called %d times, expected 2", calls)
+    }
+}
+
+func TestErrorHandlerConcurrent(t *testing.T) {
+    primary := &FlakyWriter{Broken: true}
+    logger := log.New(primary, log.LOG_DEBUG, "p: ")
+
+    var calls int32
+    started := make(chan bool)
+    release := make(chan bool)
+    logger.SetErrorHandler(func(err error, rec *log.Record) {
+        atomic.AddInt32(&calls, 1)
+        if rec.Message == "slow" {
+            started <- true
+            <-release
+        }
+    })
+
+    done := make(chan bool)
+    go func() {
+        logger.Info("slow")
+        done <- true
+    }()
+    <-started
+
+    // The handler is still running for the other goroutine, but this failure
+    // must reach it too.
+    logger.Info("concurrent")
+    if n := atomic.LoadInt32(&calls); n != 2 {
+        t.Errorf("handler called %d times, expected 2", n)
+    }
+
+    close(release)
+    <-done
+}
@@ -0,0 +1,122 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "io"
+    "time"
+)
+
+// Flags to be passed to SetFlags(), with the same values and meanings as in
+// the standard log package, plus Ltimestamp. They only affect FormatText.
+const (
+    // The date in the local time zone, e.g., 2009/01/23.
+    Ldate = 1 << iota
+    // The time in the local time zone, e.g., 01:23:23.
+    Ltime
+    // Microsecond resolution, e.g., 01:23:23.123123. Assumes Ltime.
+    Lmicroseconds
+    // The full file name and line number, e.g., /a/b/c/d.go:23.
+    Llongfile
+    // The final file name element and line number, e.g., d.go:23. Overrides
+    // Llongfile.
+    Lshortfile
+    // Use UTC rather than the local time zone for Ldate and Ltime.
+    LUTC
+    // Move the prefix from the beginning of the line to just before the
+    // message.
+    Lmsgprefix
+    // A timestamp from the logger's TimestampFunc, in its time location, at
+    // the very beginning of the line, before the prefix. This is not in the
+    // standard log package. Ldate, Ltime, Lmicroseconds, and LUTC are ignored
+    // if it is set.
+    Ltimestamp
+
+    // The initial values for the standard logger.
+    LstdFlags = Ldate | Ltime
+)
+
+// The initial flags for loggers created by this package.
+const default_flags = Ltimestamp | Lshortfile
+
+// Sets the output flags for the logger, as with the standard log package. The
+// default is Ltimestamp|Lshortfile. Setting LstdFlags gives the standard
+// layout, with the prefix first, followed by the date and time.
+func (l *Logger) SetFlags(flag int) {
+    l.core.flags = flag
+}
+
+// Returns the output flags for the logger.
+func (l *Logger) Flags() int {
+    return l.core.flags
+}
+
+// Returns the prefix for the logger.
+func (l *Logger) Prefix() string {
+    return l.core.prefix
+}
+
+// Returns the Writer the logger writes to.
+func (l *Logger) Writer() io.Writer {
+    return l.core.writer
+}
+
+// Writes a message without a severity, as the standard log package's Output
+// does. The call_depth is the number of stack frames to skip when determining
+// the source file and line number; a value of 1 uses the caller of Output().
+func (l *Logger) Output(call_depth int, s string) error {
+    return l.emit(call_depth, sev_none, s)
+}
+
+// Formats the date and time as the standard log package does for the given
+// flags, without a trailing space.
+func std_timestamp(t time.Time, flags int) string {
+    if flags & LUTC != 0 {
+        t = t.UTC()
+    } else {
+        t = t.Local()
+    }
+
+    layout := ""
+    if flags & Ldate != 0 {
+        layout = "2006/01/02"
+    }
+    if flags & (Ltime | Lmicroseconds) != 0 {
+        if layout != "" {
+            layout += " "
+        }
+        layout += "15:04:05"
+        if flags & Lmicroseconds != 0 {
+            layout += ".000000"
+        }
+    }
+    if layout == "" {
+        return ""
+    }
+
+    return t.Format(layout)
+}
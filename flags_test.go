@@ -0,0 +1,127 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    "fmt"
+    log "github.com/cuberat/go-log"
+    stdlog "log"
+    "regexp"
+    "runtime"
+    "testing"
+    "time"
+)
+
+type FlagsTest struct {
+    Name string
+    Flags int
+}
+
+var micro_re = regexp.MustCompile(`\.\d{6}`)
+
+// Checks that the output with the standard library's flags matches the
+// standard log package.
+func TestFlagsMatchStdlib(t *testing.T) {
+    tests := []*FlagsTest{
+        &FlagsTest{"none", 0},
+        &FlagsTest{"std", log.LstdFlags},
+        &FlagsTest{"date", log.Ldate},
+        &FlagsTest{"micro", log.Ltime | log.Lmicroseconds | log.LUTC},
+        &FlagsTest{"shortfile", log.LstdFlags | log.Lshortfile},
+        &FlagsTest{"longfile", log.Llongfile},
+        &FlagsTest{"both files", log.Llongfile | log.Lshortfile},
+        &FlagsTest{"msgprefix", log.LstdFlags | log.Lshortfile |
+            log.Lmsgprefix},
+    }
+
+    for _, tester := range tests {
+        t.Run(tester.Name, func(t *testing.T) {
+            buffer := new(bytes.Buffer)
+            logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+            logger.SetFlags(tester.Flags)
+            if logger.Flags() != tester.Flags {
+                t.Errorf("got flags %d, expected %d", logger.Flags(),
+                    tester.Flags)
+            }
+            std_buffer := new(bytes.Buffer)
+            std := stdlog.New(std_buffer, "p: ", tester.Flags)
+
+            // Both on one line, so that the sources match.
+            logger.Print("msg"); std.Print("msg")
+
+            got := micro_re.ReplaceAllString(buffer.String(), ".000000")
+            expected := micro_re.ReplaceAllString(std_buffer.String(),
+                ".000000")
+            if got != expected {
+                t.Errorf("got %q, expected %q", got, expected)
+            }
+        })
+    }
+}
+
+func TestFlagsTimestamp(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    logger.SetTimestampFunc(func(t time.Time) string {
+        return "TS"
+    })
+    if logger.Flags() != log.Ltimestamp | log.Lshortfile {
+        t.Errorf("unexpected default flags %d", logger.Flags())
+    }
+
+    logger.SetFlags(log.Ltimestamp | log.Lmsgprefix)
+    logger.Print("msg")
+    if buffer.String() != "TS p: msg\n" {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+}
+
+func TestStdlibAccessors(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    logger.SetFlags(log.Lshortfile)
+
+    if logger.Prefix() != "p: " {
+        t.Errorf("got prefix %q", logger.Prefix())
+    }
+    if logger.Writer() != buffer {
+        t.Errorf("Writer() didn't return the writer")
+    }
+
+    _, _, line, _ := runtime.Caller(0)
+    output_helper(logger)
+    expected := fmt.Sprintf("p: flags_test.go:%d: helped\n", line + 1)
+    if buffer.String() != expected {
+        t.Errorf("got %q, expected %q", buffer.String(), expected)
+    }
+}
+
+// Logs with a call depth of 2, so that the source is the caller.
+func output_helper(logger *log.Logger) {
+    logger.Output(2, "helped")
+}
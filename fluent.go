@@ -0,0 +1,434 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "bufio"
+    "crypto/rand"
+    "encoding/base64"
+    "fmt"
+    "net"
+    "strings"
+    "sync"
+    "time"
+)
+
+// The FluentMode type selects how a FluentWriter frames events, per the
+// Fluentd forward protocol specification.
+type FluentMode int
+
+// Modes to be passed to FluentWriter.SetMode().
+const (
+    // Each event is sent as its own [tag, time, record] message.
+    FluentModeMessage FluentMode = iota
+    // Events are sent in batches as [tag, [[time, record], ...]].
+    FluentModeForward
+    // Events are sent in batches as [tag, bin], where bin is the concatenated
+    // MessagePack encoding of the [time, record] entries.
+    FluentModePackedForward
+)
+
+// A FluentWriter sends log records to Fluentd or Fluent Bit using the forward
+// protocol over TCP or a unix socket. Pass it to New() or SetOutput().
+//
+// Each record is sent as an event with the writer's tag, the record's time as
+// an EventTime, and a record containing the keys "message", "severity" (the
+// severity name, e.g., "err"), "file", "line", "func", "prefix", and "logger"
+// (if set), along with any fields attached with With().
+//
+// In FluentModeForward and FluentModePackedForward, events are buffered until
+// the batch size is reached, the flush interval passes, or Flush() is called.
+// Flush() may be called from any goroutine. If acknowledgements are
+// required, each message carries a chunk ID that the server must acknowledge;
+// unacknowledged messages are resent on a new connection, giving
+// at-least-once delivery.
+type FluentWriter struct {
+    network string
+    addr string
+    tag string
+    conn net.Conn
+    reader *bufio.Reader
+    mode FluentMode
+    require_ack bool
+    timeout time.Duration
+    batch_size int
+    max_retries int
+    entries []byte
+    num_entries int
+    enc msgpack_encoder
+
+    // Guards the buffered entries and the connection, as Flush() may be
+    // called from another goroutine than the Logger's.
+    lock sync.Mutex
+
+    // Closed to stop the goroutine started by SetFlushInterval(), which
+    // closes flusher_done when it returns.
+    stop_flusher chan struct{}
+    flusher_done chan struct{}
+}
+
+// Creates a FluentWriter that sends events with the given tag to addr over
+// network, e.g., NewFluentWriter("tcp", "localhost:24224", "myapp").
+func NewFluentWriter(network, addr, tag string) (*FluentWriter, error) {
+    w := new(FluentWriter)
+    w.network = network
+    w.addr = addr
+    w.tag = tag
+    w.timeout = 10 * time.Second
+    w.batch_size = 1
+    w.max_retries = 3
+
+    if err := w.connect(); err != nil {
+        return nil, err
+    }
+
+    return w, nil
+}
+
+// Sets the framing mode. The default is FluentModeMessage.
+func (w *FluentWriter) SetMode(mode FluentMode) {
+    w.mode = mode
+}
+
+// Sets whether each message must be acknowledged by the server.
+func (w *FluentWriter) SetRequireAck(require_ack bool) {
+    w.require_ack = require_ack
+}
+
+// Sets the timeout for connecting, writing, and waiting for
+// acknowledgements. The default is 10 seconds.
+func (w *FluentWriter) SetTimeout(timeout time.Duration) {
+    w.timeout = timeout
+}
+
+// Sets the number of events buffered before a batch is sent in
+// FluentModeForward and FluentModePackedForward. The default is 1.
+func (w *FluentWriter) SetBatchSize(size int) {
+    if size < 1 {
+        size = 1
+    }
+    w.batch_size = size
+}
+
+// Sets how often buffered events are sent in FluentModeForward and
+// FluentModePackedForward, so that they aren't held back indefinitely when
+// few messages are logged. A background goroutine calls Flush() at this
+// interval until Close() is called; if that fails, the events stay buffered
+// and are sent with the next batch. An interval of 0, the default, turns this
+// off.
+func (w *FluentWriter) SetFlushInterval(interval time.Duration) {
+    w.stop_flushing()
+    if interval <= 0 {
+        return
+    }
+
+    stop := make(chan struct{})
+    done := make(chan struct{})
+    w.lock.Lock()
+    w.stop_flusher = stop
+    w.flusher_done = done
+    w.lock.Unlock()
+
+    go func() {
+        defer close(done)
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ticker.C:
+                w.Flush()
+            case <-stop:
+                return
+            }
+        }
+    }()
+}
+
+// Stops the goroutine started by SetFlushInterval(), if any, and waits for
+// it to return.
+func (w *FluentWriter) stop_flushing() {
+    w.lock.Lock()
+    stop, done := w.stop_flusher, w.flusher_done
+    w.stop_flusher = nil
+    w.flusher_done = nil
+    w.lock.Unlock()
+
+    if stop != nil {
+        close(stop)
+        <-done
+    }
+}
+
+// Sets the number of times a message is resent after a failed write or
+// acknowledgement. The default is 3.
+func (w *FluentWriter) SetMaxRetries(retries int) {
+    w.max_retries = retries
+}
+
+// Sends a record as an event.
+func (w *FluentWriter) WriteRecord(rec *Record) error {
+    entry := new(msgpack_encoder)
+    entry.put_array_header(2)
+    entry.put_event_time(rec.Time)
+    fluent_put_record(entry, rec)
+
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    if w.mode == FluentModeMessage {
+        return w.send_message(entry.bytes())
+    }
+
+    w.entries = append(w.entries, entry.bytes()...)
+    w.num_entries++
+    if w.num_entries >= w.batch_size {
+        return w.flush()
+    }
+
+    return nil
+}
+
+// Sends b as an event with severity LOG_INFO.
+func (w *FluentWriter) Write(b []byte) (int, error) {
+    rec := new(Record)
+    rec.Time = time.Now()
+    rec.Severity = LOG_INFO
+    rec.Message = strings.TrimSuffix(string(b), "\n")
+
+    if err := w.WriteRecord(rec); err != nil {
+        return 0, err
+    }
+
+    return len(b), nil
+}
+
+// Sends any buffered events.
+func (w *FluentWriter) Flush() error {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    return w.flush()
+}
+
+// Sends any buffered events. Must be called with the lock held.
+func (w *FluentWriter) flush() error {
+    if w.num_entries == 0 {
+        return nil
+    }
+
+    chunk, err := w.new_chunk_id()
+    if err != nil {
+        return err
+    }
+
+    w.enc.reset()
+    w.enc.put_array_header(3)
+    w.enc.put_string(w.tag)
+    if w.mode == FluentModePackedForward {
+        w.enc.put_bin(w.entries)
+    } else {
+        w.enc.put_array_header(w.num_entries)
+        w.enc.buf = append(w.enc.buf, w.entries...)
+    }
+    w.put_option(&w.enc, w.num_entries, chunk)
+
+    if err := w.send(w.enc.bytes(), chunk); err != nil {
+        return err
+    }
+
+    w.entries = w.entries[:0]
+    w.num_entries = 0
+
+    return nil
+}
+
+// Stops the flush interval, sends any buffered events, and closes the
+// connection.
+func (w *FluentWriter) Close() error {
+    w.stop_flushing()
+
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    err := w.flush()
+    if w.conn != nil {
+        if close_err := w.conn.Close(); err == nil {
+            err = close_err
+        }
+        w.conn = nil
+    }
+
+    return err
+}
+
+// Sends a single [time, record] entry in message mode, as
+// [tag, time, record, option].
+func (w *FluentWriter) send_message(entry []byte) error {
+    chunk, err := w.new_chunk_id()
+    if err != nil {
+        return err
+    }
+
+    w.enc.reset()
+    w.enc.put_array_header(4)
+    w.enc.put_string(w.tag)
+    // Drop the entry's array header, leaving time and record.
+    w.enc.buf = append(w.enc.buf, entry[1:]...)
+    w.put_option(&w.enc, 1, chunk)
+
+    return w.send(w.enc.bytes(), chunk)
+}
+
+func (w *FluentWriter) put_option(enc *msgpack_encoder, size int,
+    chunk string) {
+
+    if chunk == "" {
+        enc.put_map_header(1)
+    } else {
+        enc.put_map_header(2)
+        enc.put_string("chunk")
+        enc.put_string(chunk)
+    }
+    enc.put_string("size")
+    enc.put_int(int64(size))
+}
+
+func (w *FluentWriter) new_chunk_id() (string, error) {
+    if !w.require_ack {
+        return "", nil
+    }
+
+    id := make([]byte, 16)
+    if _, err := rand.Read(id); err != nil {
+        return "", err
+    }
+
+    return base64.StdEncoding.EncodeToString(id), nil
+}
+
+func (w *FluentWriter) send(msg []byte, chunk string) error {
+    var err error
+    for attempt := 0; attempt <= w.max_retries; attempt++ {
+        if err = w.send_once(msg, chunk); err == nil {
+            return nil
+        }
+        if w.conn != nil {
+            w.conn.Close()
+            w.conn = nil
+        }
+    }
+
+    return fmt.Errorf("Couldn't send to fluentd at %s: %s", w.addr, err)
+}
+
+func (w *FluentWriter) send_once(msg []byte, chunk string) error {
+    if w.conn == nil {
+        if err := w.connect(); err != nil {
+            return err
+        }
+    }
+
+    w.conn.SetDeadline(time.Now().Add(w.timeout))
+    if _, err := w.conn.Write(msg); err != nil {
+        return err
+    }
+    if chunk == "" {
+        return nil
+    }
+
+    resp, err := msgpack_read(w.reader)
+    if err != nil {
+        return err
+    }
+    resp_map, _ := resp.(map[string]interface{})
+    if ack, _ := resp_map["ack"].(string); ack != chunk {
+        return fmt.Errorf("Bad acknowledgement %v for chunk %s", resp, chunk)
+    }
+
+    return nil
+}
+
+func (w *FluentWriter) connect() error {
+    conn, err := net.DialTimeout(w.network, w.addr, w.timeout)
+    if err != nil {
+        return err
+    }
+    w.conn = conn
+    w.reader = bufio.NewReader(conn)
+
+    return nil
+}
+
+func fluent_put_record(enc *msgpack_encoder, rec *Record) {
+    sev := rec.Severity
+    if !rec.HasSeverity() {
+        sev = LOG_INFO
+    }
+    prefix := strings.TrimSpace(rec.Prefix)
+
+    size := 2 + len(rec.Fields)
+    if rec.File != "" {
+        size += 2
+    }
+    if rec.Func != "" {
+        size++
+    }
+    if prefix != "" {
+        size++
+    }
+    if rec.Name != "" {
+        size++
+    }
+
+    enc.put_map_header(size)
+    for _, field := range rec.Fields {
+        enc.put_string(field.Key)
+        enc.put_value(field.Value)
+    }
+    enc.put_string("message")
+    enc.put_string(rec.Message)
+    enc.put_string("severity")
+    enc.put_string(sev.name())
+    if rec.File != "" {
+        enc.put_string("file")
+        enc.put_string(rec.File)
+        enc.put_string("line")
+        enc.put_int(int64(rec.Line))
+    }
+    if rec.Func != "" {
+        enc.put_string("func")
+        enc.put_string(rec.Func)
+    }
+    if prefix != "" {
+        enc.put_string("prefix")
+        enc.put_string(prefix)
+    }
+    if rec.Name != "" {
+        enc.put_string("logger")
+        enc.put_string(rec.Name)
+    }
+}
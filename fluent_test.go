@@ -0,0 +1,356 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    log "github.com/cuberat/go-log"
+    "io"
+    "math"
+    "net"
+    "strings"
+    "testing"
+    "time"
+)
+
+// Stands in for fluentd: accepts connections, decodes forward protocol
+// messages, and acknowledges them if requested. If drop_first is set, the
+// first connection is closed without reading or acknowledging anything.
+type FluentServer struct {
+    Listener net.Listener
+    Messages chan []interface{}
+    drop_first bool
+}
+
+func NewFluentServer(t *testing.T, drop_first bool) *FluentServer {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("couldn't listen on TCP: %s", err)
+    }
+
+    fs := &FluentServer{Listener: listener,
+        Messages: make(chan []interface{}, 10), drop_first: drop_first}
+    go fs.serve()
+
+    return fs
+}
+
+func (fs *FluentServer) serve() {
+    for {
+        conn, err := fs.Listener.Accept()
+        if err != nil {
+            return
+        }
+        if fs.drop_first {
+            fs.drop_first = false
+            conn.Close()
+            continue
+        }
+        go fs.handle(conn)
+    }
+}
+
+func (fs *FluentServer) handle(conn net.Conn) {
+    defer conn.Close()
+    r := bufio.NewReader(conn)
+    for {
+        v, err := mp_decode(r)
+        if err != nil {
+            return
+        }
+        msg, _ := v.([]interface{})
+        fs.Messages <- msg
+
+        option, _ := msg[len(msg) - 1].(map[string]interface{})
+        if chunk, ok := option["chunk"].(string); ok {
+            conn.Write(append([]byte{0x81, 0xa3, 'a', 'c', 'k',
+                0xa0 | byte(len(chunk))}, chunk...))
+        }
+    }
+}
+
+func (fs *FluentServer) Next(t *testing.T) []interface{} {
+    select {
+    case msg := <-fs.Messages:
+        return msg
+    case <-time.After(5 * time.Second):
+        t.Fatalf("timed out waiting for fluentd message")
+    }
+    return nil
+}
+
+// Decodes the subset of MessagePack produced by FluentWriter. EventTime
+// values are decoded as time.Time.
+func mp_decode(r *bufio.Reader) (interface{}, error) {
+    c, err := r.ReadByte()
+    if err != nil {
+        return nil, err
+    }
+
+    read_n := func(n int) []byte {
+        b := make([]byte, n)
+        io.ReadFull(r, b)
+        return b
+    }
+    read_uint := func(n int) uint64 {
+        b := append(make([]byte, 8 - n), read_n(n)...)
+        return binary.BigEndian.Uint64(b)
+    }
+    read_array := func(n int) ([]interface{}, error) {
+        arr := make([]interface{}, n)
+        for i := range arr {
+            if arr[i], err = mp_decode(r); err != nil {
+                return nil, err
+            }
+        }
+        return arr, nil
+    }
+    read_map := func(n int) (map[string]interface{}, error) {
+        m := make(map[string]interface{}, n)
+        for i := 0; i < n; i++ {
+            k, err := mp_decode(r)
+            if err != nil {
+                return nil, err
+            }
+            if m[k.(string)], err = mp_decode(r); err != nil {
+                return nil, err
+            }
+        }
+        return m, nil
+    }
+
+    switch {
+    case c <= 0x7f:
+        return int64(c), nil
+    case c >= 0xe0:
+        return int64(int8(c)), nil
+    case c & 0xe0 == 0xa0:
+        return string(read_n(int(c & 0x1f))), nil
+    case c & 0xf0 == 0x90:
+        return read_array(int(c & 0x0f))
+    case c & 0xf0 == 0x80:
+        return read_map(int(c & 0x0f))
+    }
+
+    switch c {
+    case 0xc0:
+        return nil, nil
+    case 0xc2, 0xc3:
+        return c == 0xc3, nil
+    case 0xcc, 0xcd, 0xce, 0xcf:
+        return int64(read_uint(1 << (c - 0xcc))), nil
+    case 0xcb:
+        return math.Float64frombits(read_uint(8)), nil
+    case 0xd9, 0xda, 0xdb:
+        return string(read_n(int(read_uint(1 << (c - 0xd9))))), nil
+    case 0xc4, 0xc5, 0xc6:
+        return read_n(int(read_uint(1 << (c - 0xc4)))), nil
+    case 0xdc, 0xdd:
+        return read_array(int(read_uint(2 << (c - 0xdc))))
+    case 0xde, 0xdf:
+        return read_map(int(read_uint(2 << (c - 0xde))))
+    case 0xd7:
+        b := read_n(9)
+        return time.Unix(int64(binary.BigEndian.Uint32(b[1:5])),
+            int64(binary.BigEndian.Uint32(b[5:]))), nil
+    }
+
+    return nil, fmt.Errorf("unexpected type byte 0x%02x", c)
+}
+
+func check_fluent_entry(t *testing.T, ts interface{}, rec interface{},
+    msg string, sev string) {
+
+    if _, ok := ts.(time.Time); !ok {
+        t.Errorf("expected EventTime, got %#v", ts)
+    }
+
+    record, _ := rec.(map[string]interface{})
+    expected := map[string]interface{}{
+        "message": msg,
+        "severity": sev,
+        "prefix": "myapp [1]",
+        "user": "bob",
+    }
+    for key, val := range expected {
+        if record[key] != val {
+            t.Errorf("record key %q: got %#v, expected %#v", key, record[key],
+                val)
+        }
+    }
+    if file, _ := record["file"].(string); !strings.HasSuffix(file,
+        "fluent_test.go") {
+        t.Errorf("unexpected file %#v", record["file"])
+    }
+    if _, ok := record["line"].(int64); !ok {
+        t.Errorf("missing or non-integer line %#v", record["line"])
+    }
+}
+
+func TestFluentWriterMessage(t *testing.T) {
+    fs := NewFluentServer(t, true)
+    defer fs.Listener.Close()
+
+    w, err := log.NewFluentWriter("tcp", fs.Listener.Addr().String(), "app")
+    if err != nil {
+        t.Fatalf("couldn't create fluent writer: %s", err)
+    }
+    defer w.Close()
+    w.SetRequireAck(true)
+    w.SetTimeout(time.Second)
+
+    logger := log.New(w, log.LOG_DEBUG, "myapp [1] ").With("user", "bob")
+
+    // The first connection is dropped, so this is only delivered on retry.
+    if err := logger.Err("first"); err != nil {
+        t.Fatalf("couldn't log with acknowledgement: %s", err)
+    }
+    msg := fs.Next(t)
+    if len(msg) != 4 || msg[0] != "app" {
+        t.Fatalf("unexpected message mode event: %#v", msg)
+    }
+    check_fluent_entry(t, msg[1], msg[2], "first", "err")
+}
+
+func TestFluentWriterForward(t *testing.T) {
+    for _, mode := range []log.FluentMode{log.FluentModeForward,
+        log.FluentModePackedForward} {
+
+        fs := NewFluentServer(t, false)
+        defer fs.Listener.Close()
+
+        w, err := log.NewFluentWriter("tcp", fs.Listener.Addr().String(),
+            "app")
+        if err != nil {
+            t.Fatalf("couldn't create fluent writer: %s", err)
+        }
+        w.SetMode(mode)
+        w.SetBatchSize(10)
+        w.SetRequireAck(true)
+
+        logger := log.New(w, log.LOG_DEBUG, "myapp [1] ").With("user", "bob")
+        logger.Warning("one")
+        logger.Info("two")
+        if err := w.Close(); err != nil {
+            t.Fatalf("couldn't flush fluent writer: %s", err)
+        }
+
+        msg := fs.Next(t)
+        if len(msg) != 3 || msg[0] != "app" {
+            t.Fatalf("unexpected forward event: %#v", msg)
+        }
+
+        entries, ok := msg[1].([]interface{})
+        if mode == log.FluentModePackedForward {
+            packed, _ := msg[1].([]byte)
+            r := bufio.NewReader(bytes.NewReader(packed))
+            entries = nil
+            for {
+                entry, err := mp_decode(r)
+                if err != nil {
+                    break
+                }
+                entries = append(entries, entry)
+            }
+            ok = true
+        }
+        if !ok || len(entries) != 2 {
+            t.Fatalf("expected 2 entries, got %#v", msg[1])
+        }
+
+        first := entries[0].([]interface{})
+        check_fluent_entry(t, first[0], first[1], "one", "warning")
+        second := entries[1].([]interface{})
+        check_fluent_entry(t, second[0], second[1], "two", "info")
+    }
+}
+
+func TestFluentWriterFlushInterval(t *testing.T) {
+    fs := NewFluentServer(t, false)
+    defer fs.Listener.Close()
+
+    w, err := log.NewFluentWriter("tcp", fs.Listener.Addr().String(), "app")
+    if err != nil {
+        t.Fatalf("couldn't create fluent writer: %s", err)
+    }
+    defer w.Close()
+    w.SetMode(log.FluentModeForward)
+    w.SetBatchSize(100)
+    w.SetFlushInterval(10 * time.Millisecond)
+
+    logger := log.New(w, log.LOG_DEBUG, "myapp [1] ").With("user", "bob")
+    logger.Info("idle")
+
+    // Nothing else is logged, so only the interval sends the event.
+    msg := fs.Next(t)
+    entries, ok := msg[1].([]interface{})
+    if !ok || len(entries) != 1 {
+        t.Fatalf("expected 1 entry, got %#v", msg)
+    }
+    entry := entries[0].([]interface{})
+    check_fluent_entry(t, entry[0], entry[1], "idle", "info")
+}
+
+func TestFluentWriterConcurrentFlush(t *testing.T) {
+    fs := NewFluentServer(t, false)
+    defer fs.Listener.Close()
+
+    w, err := log.NewFluentWriter("tcp", fs.Listener.Addr().String(), "app")
+    if err != nil {
+        t.Fatalf("couldn't create fluent writer: %s", err)
+    }
+    w.SetMode(log.FluentModeForward)
+    w.SetBatchSize(5)
+
+    logger := log.New(w, log.LOG_DEBUG, "")
+    done := make(chan bool)
+    go func() {
+        for i := 0; i < 50; i++ {
+            w.Flush()
+        }
+        done <- true
+    }()
+    for i := 0; i < 100; i++ {
+        logger.Info("message")
+    }
+    <-done
+    if err := w.Close(); err != nil {
+        t.Fatalf("couldn't close fluent writer: %s", err)
+    }
+
+    total := 0
+    for total < 100 {
+        entries, _ := fs.Next(t)[1].([]interface{})
+        total += len(entries)
+    }
+    if total != 100 {
+        t.Errorf("expected 100 events, got %d", total)
+    }
+}
@@ -0,0 +1,547 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "math"
+    "reflect"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// The Format type selects the layout of the lines written to the Writer.
+type Format int
+
+// Formats to be passed to SetFormat().
+const (
+    // The default "timestamp prefix file:line: message" layout.
+    FormatText Format = iota
+    // One JSON object per line.
+    FormatJSON
+    // One line of logfmt-style key=value pairs per message.
+    FormatLogfmt
+)
+
+// The prefix added to field keys that clash with the keys FormatJSON and
+// FormatLogfmt use for the record itself, so that With("msg", "x") is written
+// as "fields.msg" and cannot override the message.
+const ReservedFieldPrefix = "fields."
+
+var reserved_keys = map[string]bool{
+    "time": true,
+    "severity": true,
+    "prefix": true,
+    "logger": true,
+    "source": true,
+    "msg": true,
+}
+
+// Returns key, prefixed with ReservedFieldPrefix if it is one of the keys
+// used for the record itself.
+func field_key(key string) string {
+    if reserved_keys[key] {
+        return ReservedFieldPrefix + key
+    }
+    return key
+}
+
+// The MultilinePolicy type selects how messages containing newlines are
+// written in FormatText. Without special handling, the continuation lines of
+// such a message have no timestamp, prefix, or source, which confuses
+// line-oriented tools and allows a message to forge log lines.
+type MultilinePolicy int
+
+// Policies to be passed to SetMultilinePolicy().
+const (
+    // Write the message as is. This is the default.
+    MultilineRaw MultilinePolicy = iota
+    // Start each continuation line with MultilineMarker.
+    MultilineIndent
+    // Repeat the timestamp, prefix, name, and source on each line, as if
+    // each line were logged separately.
+    MultilineRepeatHeader
+    // Write the message on a single line, with newlines, carriage returns,
+    // and backslashes escaped as \n, \r, and \\.
+    MultilineEscape
+)
+
+// The marker at the start of continuation lines with MultilineIndent.
+const MultilineMarker = "  | "
+
+var multiline_names = []string{"raw", "indent", "repeat", "escape"}
+
+// The SeverityLabel type selects how the severity of a message is shown in
+// FormatText. FormatJSON and FormatLogfmt always include the severity.
+type SeverityLabel int
+
+// Label styles to be passed to SetSeverityLabel().
+const (
+    // Leave the severity out. This is the default for New().
+    LabelNone SeverityLabel = iota
+    // Upper-case short names, e.g., "ERR", after the timestamp. This is the
+    // default for NewFromConfig().
+    LabelUpper
+    // Lower-case full names, e.g., "error", after the timestamp.
+    LabelLower
+    // The severity number in angle brackets, e.g., "<3>", at the very start
+    // of the line, as understood by systemd for the output of services.
+    LabelSyslog
+    // A single letter after the timestamp, as used by glog: "F" for LOG_EMERG
+    // through LOG_CRIT, "E", "W", "I" for LOG_NOTICE and LOG_INFO, and "D".
+    LabelGlog
+)
+
+var (
+    label_names = []string{"none", "upper", "lower", "syslog", "glog"}
+    sev_labels = [][]string{
+        LabelUpper: []string{"EMERG", "ALERT", "CRIT", "ERR", "WARNING",
+            "NOTICE", "INFO", "DEBUG"},
+        LabelLower: []string{"emergency", "alert", "critical", "error",
+            "warning", "notice", "info", "debug"},
+        LabelSyslog: []string{"<0>", "<1>", "<2>", "<3>", "<4>", "<5>", "<6>",
+            "<7>"},
+        LabelGlog: []string{"F", "F", "F", "E", "W", "I", "I", "D"},
+    }
+)
+
+// Used internally to mark output that has no associated severity, e.g., from
+// Print().
+const sev_none Severity = -1
+
+var (
+    format_names = []string{"text", "json", "logfmt"}
+    sev_names = []string{"emerg", "alert", "crit", "err", "warning", "notice",
+        "info", "debug"}
+)
+
+// A record along with the parts of the log line generated by the Logger.
+type record struct {
+    *Record
+    ts string
+    prefix string
+    multiline MultilinePolicy
+    label SeverityLabel
+    flags int
+
+    // Put the trace fields at the start of the message as an RFC 5424
+    // structured data element, for syslog. See TraceSDID.
+    trace_sd bool
+}
+
+// Converts a format name ("text", "json", or "logfmt") to a Format that can be
+// passed to SetFormat().
+func FormatFromString(format_string string) (Format, error) {
+    check_format := strings.ToLower(format_string)
+    for i, name := range format_names {
+        if name == check_format {
+            return Format(i), nil
+        }
+    }
+
+    return Format(0), fmt.Errorf("Unknown format %q", format_string)
+}
+
+// Returns the name of the format, as accepted by FormatFromString().
+func (f Format) String() string {
+    if f >= 0 && int(f) < len(format_names) {
+        return format_names[f]
+    }
+
+    return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Converts a policy name ("raw", "indent", "repeat", or "escape") to a
+// MultilinePolicy that can be passed to SetMultilinePolicy().
+func MultilinePolicyFromString(policy_string string) (MultilinePolicy,
+    error) {
+
+    check_policy := strings.ToLower(policy_string)
+    for i, name := range multiline_names {
+        if name == check_policy {
+            return MultilinePolicy(i), nil
+        }
+    }
+
+    return MultilinePolicy(0), fmt.Errorf("Unknown multi-line policy %q",
+        policy_string)
+}
+
+// Returns the name of the policy, as accepted by MultilinePolicyFromString().
+func (p MultilinePolicy) String() string {
+    if p >= 0 && int(p) < len(multiline_names) {
+        return multiline_names[p]
+    }
+
+    return fmt.Sprintf("MultilinePolicy(%d)", int(p))
+}
+
+// Converts a label style name ("none", "upper", "lower", "syslog", or "glog")
+// to a SeverityLabel that can be passed to SetSeverityLabel().
+func SeverityLabelFromString(label_string string) (SeverityLabel, error) {
+    check_label := strings.ToLower(label_string)
+    for i, name := range label_names {
+        if name == check_label {
+            return SeverityLabel(i), nil
+        }
+    }
+
+    return SeverityLabel(0), fmt.Errorf("Unknown severity label style %q",
+        label_string)
+}
+
+// Returns the name of the label style, as accepted by
+// SeverityLabelFromString().
+func (sl SeverityLabel) String() string {
+    if sl >= 0 && int(sl) < len(label_names) {
+        return label_names[sl]
+    }
+
+    return fmt.Sprintf("SeverityLabel(%d)", int(sl))
+}
+
+// Returns the label for sev in the given style, or an empty string if there
+// is none.
+func (sev Severity) label(style SeverityLabel) string {
+    if style <= LabelNone || int(style) >= len(sev_labels) ||
+        sev < LOG_EMERG || int(sev) >= len(sev_labels[style]) {
+        return ""
+    }
+
+    return sev_labels[style][sev]
+}
+
+// Formats rec as a line of output in format f, as a Logger would with the given
+// timestamp text. This is useful for converting records read with a Reader
+// between formats. FormatText output shows the severity with LabelUpper, so
+// that it can be read back.
+func FormatRecord(f Format, rec *Record, timestamp string) string {
+    return f.format_record(&record{Record: rec, ts: timestamp,
+        prefix: rec.Prefix, label: LabelUpper, flags: default_flags})
+}
+
+func (f Format) format_record(rec *record) string {
+    b := new(bytes.Buffer)
+    f.write_record(b, rec)
+
+    return b.String()
+}
+
+// Appends rec to b as a line of output in format f.
+func (f Format) write_record(b *bytes.Buffer, rec *record) {
+    switch f {
+    case FormatJSON:
+        write_json(b, rec)
+    case FormatLogfmt:
+        write_logfmt(b, rec)
+    default:
+        write_text(b, rec)
+    }
+}
+
+func (sev Severity) name() string {
+    if sev >= 0 && int(sev) < len(sev_names) {
+        return sev_names[sev]
+    }
+
+    return strconv.Itoa(int(sev))
+}
+
+// Formats a record as text. With Ltimestamp, the timestamp comes first, as
+// in the package's original layout; otherwise, the prefix comes first, as in
+// the standard log package.
+func format_text(rec *record) string {
+    b := new(bytes.Buffer)
+    write_text(b, rec)
+
+    return b.String()
+}
+
+// Appends a record to b as text. See format_text().
+func write_text(b *bytes.Buffer, rec *record) {
+    header_start := b.Len()
+
+    fields := rec.Fields
+    if rec.trace_sd {
+        var sd string
+        if sd, fields = trace_sd_element(fields); sd != "" {
+            b.WriteString(sd)
+            b.WriteByte(' ')
+        }
+    }
+
+    label := rec.Severity.label(rec.label)
+    if rec.label == LabelSyslog {
+        b.WriteString(label)
+    }
+    std_layout := rec.flags & Ltimestamp == 0
+    msg_prefix := rec.flags & Lmsgprefix != 0
+    if std_layout && !msg_prefix {
+        b.WriteString(rec.prefix)
+    }
+    if rec.ts != "" {
+        b.WriteString(rec.ts)
+        b.WriteByte(' ')
+    }
+    if label != "" && rec.label != LabelSyslog {
+        b.WriteString(label)
+        b.WriteByte(' ')
+    }
+    if !std_layout && !msg_prefix {
+        b.WriteString(rec.prefix)
+    }
+    if rec.Name != "" {
+        b.WriteString(rec.Name)
+        b.WriteString(": ")
+    }
+    switch {
+    case rec.flags & Lshortfile != 0:
+        b.WriteString(rec.Source())
+        b.WriteString(": ")
+    case rec.flags & Llongfile != 0:
+        b.WriteString(rec.File)
+        b.WriteByte(':')
+        b.WriteString(strconv.Itoa(rec.Line))
+        b.WriteString(": ")
+    }
+    if msg_prefix {
+        b.WriteString(rec.prefix)
+    }
+
+    msg := rec.Message
+    switch {
+    case rec.multiline == MultilineEscape:
+        multiline_escaper.WriteString(b, msg)
+    case strings.IndexByte(msg, '\n') < 0:
+        b.WriteString(msg)
+    case rec.multiline == MultilineIndent:
+        b.WriteString(strings.Replace(msg, "\n", "\n" + MultilineMarker, -1))
+    case rec.multiline == MultilineRepeatHeader:
+        header := string(b.Bytes()[header_start:])
+        b.WriteString(strings.Replace(msg, "\n", "\n" + header, -1))
+    default:
+        b.WriteString(msg)
+    }
+
+    for _, field := range fields {
+        b.WriteByte(' ')
+        write_logfmt_key(b, field.Key)
+        b.WriteByte('=')
+        write_logfmt_value(b, field_string(field.Value))
+    }
+    b.WriteByte('\n')
+}
+
+var multiline_escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`,
+    "\r", `\r`)
+
+// Appends a record to b as a JSON object.
+func write_json(b *bytes.Buffer, rec *record) {
+    b.WriteByte('{')
+    sep := false
+    add_key := func(key string) {
+        if sep {
+            b.WriteByte(',')
+        }
+        write_json_string(b, key)
+        b.WriteByte(':')
+        sep = true
+    }
+    add := func(key, val string) {
+        add_key(key)
+        write_json_string(b, val)
+    }
+
+    if rec.ts != "" {
+        add("time", rec.ts)
+    }
+    if rec.HasSeverity() {
+        add("severity", rec.Severity.name())
+    }
+    if prefix := strings.TrimSpace(rec.prefix); prefix != "" {
+        add("prefix", prefix)
+    }
+    if rec.Name != "" {
+        add("logger", rec.Name)
+    }
+    add("source", rec.Source())
+    add("msg", rec.Message)
+    for _, field := range rec.Fields {
+        add_key(field_key(field.Key))
+        write_json_value(b, field.Value)
+    }
+    b.WriteString("}\n")
+}
+
+// Appends a record to b as a line of logfmt.
+func write_logfmt(b *bytes.Buffer, rec *record) {
+    sep := false
+    add := func(key, val string) {
+        if sep {
+            b.WriteByte(' ')
+        }
+        write_logfmt_key(b, key)
+        b.WriteByte('=')
+        write_logfmt_value(b, val)
+        sep = true
+    }
+
+    if rec.ts != "" {
+        add("time", rec.ts)
+    }
+    if rec.HasSeverity() {
+        add("severity", rec.Severity.name())
+    }
+    if prefix := strings.TrimSpace(rec.prefix); prefix != "" {
+        add("prefix", prefix)
+    }
+    if rec.Name != "" {
+        add("logger", rec.Name)
+    }
+    add("source", rec.Source())
+    add("msg", rec.Message)
+    for _, field := range rec.Fields {
+        add(field_key(field.Key), field_string(field.Value))
+    }
+    b.WriteByte('\n')
+}
+
+// Returns the string form of a field value.
+func field_string(v interface{}) string {
+    switch val := v.(type) {
+    case string:
+        return val
+    case nil:
+        return "<nil>"
+    }
+
+    return fmt.Sprint(v)
+}
+
+// Writes a field value as JSON. Numbers, booleans, and nil are written as
+// such, errors and fmt.Stringers as their string form, and anything else as
+// encoded by encoding/json, falling back to its fmt.Sprint() form.
+func write_json_value(b *bytes.Buffer, v interface{}) {
+    switch val := v.(type) {
+    case nil:
+        b.WriteString("null")
+    case string:
+        write_json_string(b, val)
+    case bool:
+        b.WriteString(strconv.FormatBool(val))
+    case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+        fmt.Fprint(b, val)
+    case float32, float64:
+        f := reflect.ValueOf(val).Float()
+        if math.IsInf(f, 0) || math.IsNaN(f) {
+            write_json_string(b, fmt.Sprint(f))
+        } else {
+            b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+        }
+    case error, fmt.Stringer:
+        // fmt.Sprint() copes with nil receivers, e.g., a nil *MyError.
+        write_json_string(b, fmt.Sprint(val))
+    default:
+        data, err := json.Marshal(val)
+        if err != nil {
+            write_json_string(b, fmt.Sprint(val))
+            return
+        }
+        b.Write(data)
+    }
+}
+
+// Writes s as a JSON string, including the surrounding quotes.
+func write_json_string(b *bytes.Buffer, s string) {
+    const hex = "0123456789abcdef"
+
+    b.WriteByte('"')
+    for _, r := range s {
+        switch {
+        case r == '"' || r == '\\':
+            b.WriteByte('\\')
+            b.WriteRune(r)
+        case r == '\n':
+            b.WriteString(`\n`)
+        case r == '\r':
+            b.WriteString(`\r`)
+        case r == '\t':
+            b.WriteString(`\t`)
+        case r < 0x20 || r == '\u2028' || r == '\u2029':
+            b.WriteString(`\u`)
+            for shift := 12; shift >= 0; shift -= 4 {
+                b.WriteByte(hex[(r >> uint(shift)) & 0xf])
+            }
+        case r == utf8.RuneError:
+            b.WriteString(`\ufffd`)
+        default:
+            b.WriteRune(r)
+        }
+    }
+    b.WriteByte('"')
+}
+
+// Writes s as a logfmt value, quoting it if necessary.
+func write_logfmt_value(b *bytes.Buffer, s string) {
+    if s == "" {
+        b.WriteString(`""`)
+        return
+    }
+    if strings.IndexFunc(s, logfmt_needs_quote) >= 0 {
+        b.WriteString(strconv.Quote(s))
+        return
+    }
+    b.WriteString(s)
+}
+
+// Writes s as a logfmt key. Keys can't be quoted, so characters that would
+// need quoting are replaced with underscores, as is an empty key.
+func write_logfmt_key(b *bytes.Buffer, s string) {
+    if s == "" {
+        b.WriteByte('_')
+        return
+    }
+    if strings.IndexFunc(s, logfmt_needs_quote) < 0 {
+        b.WriteString(s)
+        return
+    }
+    for _, r := range s {
+        if logfmt_needs_quote(r) {
+            b.WriteByte('_')
+        } else {
+            b.WriteRune(r)
+        }
+    }
+}
+
+func logfmt_needs_quote(r rune) bool {
+    return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError ||
+        r == 0x7f
+}
@@ -0,0 +1,249 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    "fmt"
+    log "github.com/cuberat/go-log"
+    "regexp"
+    "strings"
+    "testing"
+    "time"
+)
+
+var source_re = regexp.MustCompile(`format_test\.go:\d+: `)
+
+type MultilineTest struct {
+    Policy log.MultilinePolicy
+    Expected string
+}
+
+func TestMultilinePolicy(t *testing.T) {
+    msg := "first\nsecond \\ line\nthird"
+
+    tests := []*MultilineTest{
+        &MultilineTest{log.MultilineRaw,
+            "p: f.go:1: first\nsecond \\ line\nthird\n"},
+        &MultilineTest{log.MultilineIndent,
+            "p: f.go:1: first\n  | second \\ line\n  | third\n"},
+        &MultilineTest{log.MultilineRepeatHeader,
+            "p: f.go:1: first\np: f.go:1: second \\ line\np: f.go:1: third\n"},
+        &MultilineTest{log.MultilineEscape,
+            "p: f.go:1: first\\nsecond \\\\ line\\nthird\n"},
+    }
+
+    for _, tester := range tests {
+        t.Run(tester.Policy.String(), func(t *testing.T) {
+            buffer := new(bytes.Buffer)
+            logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+            logger.SetTimestampFunc(nil)
+            logger.SetMultilinePolicy(tester.Policy)
+            logger.Info(msg)
+
+            // Normalize the source line number.
+            output := buffer.String()
+            output = source_re.ReplaceAllString(output, "f.go:1: ")
+            if output != tester.Expected {
+                t.Errorf("got %q, expected %q", output, tester.Expected)
+            }
+
+            if tester.Policy == log.MultilineRepeatHeader {
+                return
+            }
+
+            lr := log.NewReader(strings.NewReader(output))
+            lr.SetMultilinePolicy(tester.Policy)
+            rec, err := lr.Next()
+            if err != nil {
+                t.Fatalf("couldn't read back record: %s", err)
+            }
+            if rec.Message != msg {
+                t.Errorf("read back message %q, expected %q", rec.Message, msg)
+            }
+        })
+    }
+}
+
+func TestMultilinePolicySyslog(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    syslog_logger := &SyslogLikeLogger{Writer: buffer}
+    logger := log.New(syslog_logger, log.LOG_DEBUG, "")
+
+    logger.SetMultilinePolicy(log.MultilineIndent)
+    logger.Err("one\ntwo")
+    if !strings.Contains(buffer.String(), "one\n  | two\n") {
+        t.Errorf("expected indented continuation, got %q", buffer.String())
+    }
+
+    // Each line is sent as a separate syslog message, which SyslogLikeLogger
+    // terminates with an extra newline.
+    buffer.Reset()
+    logger.SetMultilinePolicy(log.MultilineRepeatHeader)
+    logger.Err("one\ntwo")
+    lines := strings.Split(strings.TrimSpace(buffer.String()), "\n\n")
+    if len(lines) != 2 || !strings.HasSuffix(lines[1], ": two") ||
+        !strings.Contains(lines[1], "format_test.go:") {
+        t.Errorf("expected two syslog messages with headers, got %q",
+            buffer.String())
+    }
+}
+
+type SeverityLabelTest struct {
+    Style log.SeverityLabel
+    Expected string
+}
+
+func TestSeverityLabel(t *testing.T) {
+    const ts = "2020-01-02T03:04:05Z"
+    tests := []*SeverityLabelTest{
+        &SeverityLabelTest{log.LabelNone, ts + " p: f.go:1: msg\n"},
+        &SeverityLabelTest{log.LabelUpper, ts + " ERR p: f.go:1: msg\n"},
+        &SeverityLabelTest{log.LabelLower, ts + " error p: f.go:1: msg\n"},
+        &SeverityLabelTest{log.LabelSyslog, "<3>" + ts + " p: f.go:1: msg\n"},
+        &SeverityLabelTest{log.LabelGlog, ts + " E p: f.go:1: msg\n"},
+    }
+
+    for _, tester := range tests {
+        t.Run(tester.Style.String(), func(t *testing.T) {
+            buffer := new(bytes.Buffer)
+            logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+            logger.SetTimestampFunc(func(t time.Time) string {
+                return ts
+            })
+            logger.SetSeverityLabel(tester.Style)
+            logger.Err("msg")
+            logger.Print("no label")
+
+            output := source_re.ReplaceAllString(buffer.String(), "f.go:1: ")
+            lines := strings.SplitAfter(output, "\n")
+            if lines[0] != tester.Expected {
+                t.Errorf("got %q, expected %q", lines[0], tester.Expected)
+            }
+            if lines[1] != ts + " p: f.go:1: no label\n" {
+                t.Errorf("unexpected label without a severity: %q", lines[1])
+            }
+
+            if tester.Style == log.LabelNone {
+                return
+            }
+            rec := log.ParseLine(lines[0])
+            if rec.Malformed || rec.Severity != log.LOG_ERR ||
+                rec.Prefix != "p: " || rec.Message != "msg" {
+                t.Errorf("couldn't read back record: %s", rec)
+            }
+        })
+    }
+}
+
+func TestSeverityWriter(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_WARNING, "p: ")
+    logger.SetTimestampFunc(nil)
+    logger.SetSeverityLabel(log.LabelUpper)
+
+    fmt.Fprintf(logger.SeverityWriter(log.LOG_ERR), "disk %s\n", "full")
+    fmt.Fprintf(logger.SeverityWriter(log.LOG_INFO), "hidden\n")
+
+    output := buffer.String()
+    if !strings.HasPrefix(output, "ERR p: ") ||
+        !strings.HasSuffix(output, ": disk full\n") ||
+        strings.Count(output, "\n") != 1 {
+        t.Errorf("unexpected output %q", output)
+    }
+}
+
+func TestFieldKeyEscaping(t *testing.T) {
+    for _, format := range []log.Format{log.FormatText, log.FormatLogfmt} {
+        t.Run(format.String(), func(t *testing.T) {
+            buffer := new(bytes.Buffer)
+            logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+            logger.SetFormat(format)
+            logger.SetMultilinePolicy(log.MultilineEscape)
+            logger.With("k\nfake", "v", "a b=c", 1, "", 2).Info("m")
+
+            output := buffer.String()
+            if strings.Count(output, "\n") != 1 ||
+                !strings.HasSuffix(output, " k_fake=v a_b_c=1 _=2\n") {
+                t.Errorf("unexpected output %q", output)
+            }
+        })
+    }
+}
+
+func TestFieldsCopy(t *testing.T) {
+    logger := log.New(new(bytes.Buffer), log.LOG_DEBUG, "").With("k", "v")
+    fields := logger.Fields()
+    fields[0].Value = "changed"
+    if logger.Fields()[0].Value != "v" {
+        t.Errorf("Fields() returned the logger's own slice")
+    }
+}
+
+type NilError struct {
+    msg string
+}
+
+func (e *NilError) Error() string {
+    return e.msg
+}
+
+func TestJSONTypedNilField(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    logger.SetFormat(log.FormatJSON)
+
+    var err *NilError
+    logger.With("err", err, "ok", &NilError{"fine"}).Info("x")
+    if !strings.HasSuffix(buffer.String(),
+        `"msg":"x","err":"<nil>","ok":"fine"}` + "\n") {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+}
+
+func TestReservedFieldKeys(t *testing.T) {
+    for _, format := range []log.Format{log.FormatJSON, log.FormatLogfmt} {
+        buffer := new(bytes.Buffer)
+        logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+        logger.SetFormat(format)
+
+        logger.With("msg", "forged", "severity", "emerg").Info("real")
+        rec := log.ParseLine(buffer.String())
+        if rec == nil {
+            t.Fatalf("%v: couldn't parse %q", format, buffer.String())
+        }
+        if rec.Message != "real" || rec.Severity != log.LOG_INFO {
+            t.Errorf("%v: got message %q, severity %v from %q", format,
+                rec.Message, rec.Severity, buffer.String())
+        }
+        if !strings.Contains(buffer.String(), "fields.msg") ||
+            !strings.Contains(buffer.String(), "fields.severity") {
+            t.Errorf("%v: reserved keys not renamed in %q", format,
+                buffer.String())
+        }
+    }
+}
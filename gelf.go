@@ -0,0 +1,297 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "bytes"
+    "compress/gzip"
+    "compress/zlib"
+    "crypto/rand"
+    "encoding/json"
+    "fmt"
+    "math"
+    "net"
+    "os"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// The GELFCompression type selects how GELF messages sent over UDP are
+// compressed.
+type GELFCompression int
+
+// Compression methods to be passed to GELFWriter.SetCompression().
+const (
+    GELFCompressGzip GELFCompression = iota
+    GELFCompressZlib
+    GELFCompressNone
+)
+
+// Chunk sizes for GELF over UDP. GELFChunkSizeWAN is the default.
+const (
+    GELFChunkSizeWAN = 1420
+    GELFChunkSizeLAN = 8154
+)
+
+const (
+    gelf_chunk_header_len = 12
+    gelf_max_chunks = 128
+)
+
+var gelf_field_name_re = regexp.MustCompile(`[^\w\.\-]`)
+
+// A GELFWriter sends log records to Graylog or another receiver of the Graylog
+// Extended Log Format (GELF), version 1.1, over UDP or TCP. Pass it to New() or
+// SetOutput().
+//
+// The severity of each record is sent as the GELF level, which uses the same
+// numbering as Severity. The source file and line are sent as "_file" and
+// "_line", the function as "_func", the logger's name as "_logger", its prefix
+// as "_prefix", and fields attached with With() as additional fields with an
+// underscore prepended to their keys.
+//
+// Over UDP, messages larger than the chunk size are compressed (gzip by
+// default) and, if still too large, split into GELF chunks. Over TCP,
+// messages are sent uncompressed, terminated by a null byte, as GELF requires.
+type GELFWriter struct {
+    conn net.Conn
+    is_udp bool
+    host string
+    compression GELFCompression
+    chunk_size int
+}
+
+// Creates a GELFWriter sending to addr (host:port) over network, which must be
+// "udp", "udp4", "udp6", "tcp", "tcp4", or "tcp6".
+func NewGELFWriter(network, addr string) (*GELFWriter, error) {
+    w := new(GELFWriter)
+
+    switch network {
+    case "udp", "udp4", "udp6":
+        w.is_udp = true
+    case "tcp", "tcp4", "tcp6":
+    default:
+        return nil, fmt.Errorf("Unsupported network %q for GELF", network)
+    }
+
+    conn, err := net.Dial(network, addr)
+    if err != nil {
+        return nil, err
+    }
+    w.conn = conn
+
+    w.host, err = os.Hostname()
+    if err != nil {
+        w.host = "localhost"
+    }
+    w.chunk_size = GELFChunkSizeWAN
+
+    return w, nil
+}
+
+// Sets the compression used for UDP messages that exceed the chunk size.
+func (w *GELFWriter) SetCompression(c GELFCompression) {
+    w.compression = c
+}
+
+// Sets the maximum size of UDP datagrams. Larger messages are chunked.
+func (w *GELFWriter) SetChunkSize(size int) {
+    if size <= gelf_chunk_header_len {
+        size = GELFChunkSizeWAN
+    }
+    w.chunk_size = size
+}
+
+// Sets the "host" field sent with each message. The default is the hostname.
+func (w *GELFWriter) SetHost(host string) {
+    w.host = host
+}
+
+// Sends a record as a GELF message.
+func (w *GELFWriter) WriteRecord(rec *Record) error {
+    msg := make(map[string]interface{}, 10 + len(rec.Fields))
+
+    for _, field := range rec.Fields {
+        name := "_" + gelf_field_name_re.ReplaceAllString(field.Key, "_")
+        if name == "_id" {
+            name = "__id"
+        }
+        msg[name] = gelf_field_value(field.Value)
+    }
+
+    msg["version"] = "1.1"
+    msg["host"] = w.host
+    msg["timestamp"] = float64(rec.Time.UnixNano() / 1000) / 1e6
+
+    short_msg := rec.Message
+    if idx := strings.IndexByte(short_msg, '\n'); idx >= 0 {
+        short_msg = short_msg[:idx]
+        msg["full_message"] = rec.Message
+    }
+    msg["short_message"] = short_msg
+
+    sev := rec.Severity
+    if !rec.HasSeverity() {
+        sev = LOG_INFO
+    }
+    msg["level"] = int(sev)
+
+    if rec.File != "" {
+        msg["_file"] = rec.File
+        msg["_line"] = rec.Line
+    }
+    if rec.Func != "" {
+        msg["_func"] = rec.Func
+    }
+    if rec.Name != "" {
+        msg["_logger"] = rec.Name
+    }
+    if prefix := strings.TrimSpace(rec.Prefix); prefix != "" {
+        msg["_prefix"] = prefix
+    }
+
+    data, err := json.Marshal(msg)
+    if err != nil {
+        return err
+    }
+
+    return w.send(data)
+}
+
+// Sends b as a GELF message with level LOG_INFO.
+func (w *GELFWriter) Write(b []byte) (int, error) {
+    rec := new(Record)
+    rec.Severity = LOG_INFO
+    rec.Message = strings.TrimSuffix(string(b), "\n")
+    rec.Time = time.Now()
+
+    if err := w.WriteRecord(rec); err != nil {
+        return 0, err
+    }
+
+    return len(b), nil
+}
+
+// Closes the connection.
+func (w *GELFWriter) Close() error {
+    return w.conn.Close()
+}
+
+func (w *GELFWriter) send(data []byte) error {
+    if !w.is_udp {
+        data = append(data, 0)
+        _, err := w.conn.Write(data)
+        return err
+    }
+
+    if len(data) > w.chunk_size && w.compression != GELFCompressNone {
+        compressed, err := w.compress(data)
+        if err != nil {
+            return err
+        }
+        data = compressed
+    }
+
+    if len(data) <= w.chunk_size {
+        _, err := w.conn.Write(data)
+        return err
+    }
+
+    return w.send_chunked(data)
+}
+
+func (w *GELFWriter) compress(data []byte) ([]byte, error) {
+    buf := new(bytes.Buffer)
+
+    var err error
+    if w.compression == GELFCompressZlib {
+        zw := zlib.NewWriter(buf)
+        if _, err = zw.Write(data); err == nil {
+            err = zw.Close()
+        }
+    } else {
+        gw := gzip.NewWriter(buf)
+        if _, err = gw.Write(data); err == nil {
+            err = gw.Close()
+        }
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    return buf.Bytes(), nil
+}
+
+func (w *GELFWriter) send_chunked(data []byte) error {
+    payload_size := w.chunk_size - gelf_chunk_header_len
+    num_chunks := (len(data) + payload_size - 1) / payload_size
+    if num_chunks > gelf_max_chunks {
+        return fmt.Errorf("GELF message too large: %d bytes in %d chunks",
+            len(data), num_chunks)
+    }
+
+    msg_id := make([]byte, 8)
+    if _, err := rand.Read(msg_id); err != nil {
+        return err
+    }
+
+    chunk := make([]byte, 0, w.chunk_size)
+    for i := 0; i < num_chunks; i++ {
+        end := (i + 1) * payload_size
+        if end > len(data) {
+            end = len(data)
+        }
+
+        chunk = append(chunk[:0], 0x1e, 0x0f)
+        chunk = append(chunk, msg_id...)
+        chunk = append(chunk, byte(i), byte(num_chunks))
+        chunk = append(chunk, data[i * payload_size:end]...)
+
+        if _, err := w.conn.Write(chunk); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// GELF additional fields must be strings or numbers.
+func gelf_field_value(v interface{}) interface{} {
+    switch val := v.(type) {
+    case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+        return val
+    case float32:
+        return gelf_field_value(float64(val))
+    case float64:
+        if !math.IsNaN(val) && !math.IsInf(val, 0) {
+            return val
+        }
+    }
+
+    return field_string(v)
+}
@@ -0,0 +1,214 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "compress/zlib"
+    "encoding/json"
+    log "github.com/cuberat/go-log"
+    "io"
+    "io/ioutil"
+    "net"
+    "strings"
+    "testing"
+    "time"
+)
+
+// Reads a GELF message from a UDP socket, reassembling chunks and
+// decompressing as needed.
+func read_gelf_udp(t *testing.T, conn net.PacketConn) map[string]interface{} {
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+    var chunks [][]byte
+    buf := make([]byte, 65536)
+    for {
+        n, _, err := conn.ReadFrom(buf)
+        if err != nil {
+            t.Fatalf("couldn't read GELF datagram: %s", err)
+        }
+        datagram := append([]byte{}, buf[:n]...)
+
+        if n < 2 || datagram[0] != 0x1e || datagram[1] != 0x0f {
+            return decode_gelf(t, datagram)
+        }
+
+        seq, count := int(datagram[10]), int(datagram[11])
+        if chunks == nil {
+            chunks = make([][]byte, count)
+        }
+        chunks[seq] = datagram[12:]
+
+        done := true
+        for _, chunk := range chunks {
+            if chunk == nil {
+                done = false
+            }
+        }
+        if done {
+            return decode_gelf(t, bytes.Join(chunks, nil))
+        }
+    }
+}
+
+func decode_gelf(t *testing.T, data []byte) map[string]interface{} {
+    var r io.Reader = bytes.NewReader(data)
+    var err error
+    switch {
+    case len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b:
+        r, err = gzip.NewReader(r)
+    case len(data) > 1 && data[0] == 0x78:
+        r, err = zlib.NewReader(r)
+    }
+    if err != nil {
+        t.Fatalf("couldn't decompress GELF message: %s", err)
+    }
+
+    plain, err := ioutil.ReadAll(r)
+    if err != nil {
+        t.Fatalf("couldn't decompress GELF message: %s", err)
+    }
+
+    msg := make(map[string]interface{})
+    if err := json.Unmarshal(plain, &msg); err != nil {
+        t.Fatalf("couldn't decode GELF message %q: %s", plain, err)
+    }
+
+    return msg
+}
+
+func check_gelf_msg(t *testing.T, msg map[string]interface{},
+    expected map[string]interface{}) {
+
+    for key, val := range expected {
+        if msg[key] != val {
+            t.Errorf("GELF field %s: got %#v, expected %#v", key, msg[key], val)
+        }
+    }
+    if file, _ := msg["_file"].(string); !strings.HasSuffix(file,
+        "gelf_test.go") {
+        t.Errorf("unexpected _file %q", file)
+    }
+    if _, ok := msg["_line"].(float64); !ok {
+        t.Errorf("missing or non-numeric _line: %#v", msg["_line"])
+    }
+}
+
+func TestGELFWriterUDP(t *testing.T) {
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("couldn't listen on UDP: %s", err)
+    }
+    defer conn.Close()
+
+    w, err := log.NewGELFWriter("udp", conn.LocalAddr().String())
+    if err != nil {
+        t.Fatalf("couldn't create GELF writer: %s", err)
+    }
+    defer w.Close()
+    w.SetHost("testhost")
+
+    logger := log.New(w, log.LOG_DEBUG, "myapp [1] ").With("user", "bob",
+        "attempt", 3)
+
+    logger.Warning("first line\nsecond line")
+    check_gelf_msg(t, read_gelf_udp(t, conn), map[string]interface{}{
+        "version": "1.1",
+        "host": "testhost",
+        "level": float64(4),
+        "short_message": "first line",
+        "full_message": "first line\nsecond line",
+        "_prefix": "myapp [1]",
+        "_user": "bob",
+        "_attempt": float64(3),
+    })
+
+    // Incompressible enough to need chunking even after compression.
+    big := make([]byte, 0, 40000)
+    for i := 0; len(big) < cap(big); i++ {
+        big = append(big, byte('a' + (i * 7919) % 26))
+        big = append(big, byte('a' + (i * i) % 26))
+    }
+
+    for _, compression := range []log.GELFCompression{log.GELFCompressGzip,
+        log.GELFCompressZlib, log.GELFCompressNone} {
+        w.SetCompression(compression)
+        logger.Err(string(big))
+        check_gelf_msg(t, read_gelf_udp(t, conn), map[string]interface{}{
+            "level": float64(3),
+            "short_message": string(big),
+        })
+    }
+}
+
+func TestGELFWriterTCP(t *testing.T) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("couldn't listen on TCP: %s", err)
+    }
+    defer listener.Close()
+
+    msgs := make(chan []byte, 2)
+    go func() {
+        conn, err := listener.Accept()
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+
+        r := bufio.NewReader(conn)
+        for {
+            msg, err := r.ReadBytes(0)
+            if err != nil {
+                close(msgs)
+                return
+            }
+            msgs <- msg[:len(msg) - 1]
+        }
+    }()
+
+    w, err := log.NewGELFWriter("tcp", listener.Addr().String())
+    if err != nil {
+        t.Fatalf("couldn't create GELF writer: %s", err)
+    }
+
+    logger := log.New(w, log.LOG_DEBUG, "")
+    logger.Crit("crit msg")
+    logger.Info("info msg")
+    w.Close()
+
+    check_gelf_msg(t, decode_gelf(t, <-msgs), map[string]interface{}{
+        "level": float64(2),
+        "short_message": "crit msg",
+    })
+    check_gelf_msg(t, decode_gelf(t, <-msgs), map[string]interface{}{
+        "level": float64(6),
+        "short_message": "info msg",
+    })
+}
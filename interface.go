@@ -0,0 +1,72 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+// The SeverityLogger interface is the set of severity methods of Logger. Code
+// that accepts a SeverityLogger instead of a *Logger can be given a NopLogger,
+// a RecordingLogger, or another implementation.
+type SeverityLogger interface {
+    Alert(m string) error
+    Alertf(format string, v ...interface{}) error
+    Crit(m string) error
+    Critf(format string, v ...interface{}) error
+    Debug(m string) error
+    Debugf(format string, v ...interface{}) error
+    Emerg(m string) error
+    Emergf(format string, v ...interface{}) error
+    Err(m string) error
+    Errf(format string, v ...interface{}) error
+    Info(m string) error
+    Infof(format string, v ...interface{}) error
+    Notice(m string) error
+    Noticef(format string, v ...interface{}) error
+    Warning(m string) error
+    Warningf(format string, v ...interface{}) error
+}
+
+// The StdLogger interface is the set of methods of Logger in the style of the
+// standard log package.
+type StdLogger interface {
+    Print(v ...interface{}) error
+    Printf(format string, v ...interface{}) error
+    Println(v ...interface{}) error
+    Fatal(v ...interface{})
+    Fatalf(format string, v ...interface{})
+    Fatalln(v ...interface{})
+    Panic(v ...interface{})
+    Panicf(format string, v ...interface{})
+    Panicln(v ...interface{})
+}
+
+var (
+    _ SeverityLogger = (*Logger)(nil)
+    _ StdLogger = (*Logger)(nil)
+    _ SeverityLogger = NopLogger{}
+    _ StdLogger = NopLogger{}
+    _ SeverityLogger = (*RecordingLogger)(nil)
+    _ StdLogger = (*RecordingLogger)(nil)
+)
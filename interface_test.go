@@ -0,0 +1,108 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "path"
+    "testing"
+)
+
+// Code under test that accepts any implementation.
+func do_work(logger log.SeverityLogger, std log.StdLogger) {
+    logger.Infof("working on %d items", 3)
+    logger.Err("item 2 failed")
+    std.Print("done")
+}
+
+func TestInterfaces(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    do_work(logger, logger)
+    if buffer.Len() == 0 {
+        t.Errorf("Logger didn't log")
+    }
+
+    do_work(log.NopLogger{}, log.NopLogger{})
+
+    // Reaching Fatal must not end the test binary.
+    var nop log.StdLogger = log.NopLogger{}
+    nop.Fatal("fatal")
+    nop.Fatalf("fatal %d", 1)
+    nop.Fatalln("fatal")
+}
+
+func TestRecordingLogger(t *testing.T) {
+    recorder := log.NewRecordingLogger()
+    do_work(recorder, recorder)
+
+    expected := []string{"working on 3 items", "item 2 failed", "done"}
+    msgs := recorder.Messages()
+    if len(msgs) != len(expected) {
+        t.Fatalf("got messages %q, expected %q", msgs, expected)
+    }
+    for i, msg := range msgs {
+        if msg != expected[i] {
+            t.Errorf("message %d: got %q, expected %q", i, msg, expected[i])
+        }
+    }
+
+    recs := recorder.Records()
+    if recs[1].Severity != log.LOG_ERR || recs[2].HasSeverity() {
+        t.Errorf("unexpected severities %d, %d", recs[1].Severity,
+            recs[2].Severity)
+    }
+    if path.Base(recs[0].File) != "interface_test.go" ||
+        recs[0].Func != "github.com/cuberat/go-log_test.do_work" {
+        t.Errorf("unexpected source %s in %s", recs[0].Source(), recs[0].Func)
+    }
+
+    recorder.Fatalf("giving up after %d", 2)
+    if !recorder.Exited() {
+        t.Errorf("Fatalf() didn't mark the logger as exited")
+    }
+    last := recorder.Records()[3]
+    if last.Severity != log.LOG_CRIT || last.Message != "giving up after 2" ||
+        path.Base(last.File) != "interface_test.go" {
+        t.Errorf("unexpected fatal record %+v", last)
+    }
+
+    func() {
+        defer func() {
+            if r := recover(); r != "oops" {
+                t.Errorf("recovered %v, expected \"oops\"", r)
+            }
+        }()
+        recorder.Panic("oops")
+    }()
+
+    recorder.Reset()
+    if len(recorder.Records()) != 0 || recorder.Exited() {
+        t.Errorf("Reset() didn't clear the logger")
+    }
+}
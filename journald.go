@@ -0,0 +1,267 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+//go:build linux
+// +build linux
+
+package log
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+    "syscall"
+)
+
+// The path of the socket on which journald accepts native protocol messages.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// A JournalWriter sends log records to the systemd journal using its native
+// protocol, so that the severity, source location, identifier, and fields of
+// each record are stored as journal fields rather than flattened into text.
+// Pass it to New() or SetOutput(), e.g.,
+//
+//   w, err := log.NewJournalWriter()
+//   if err != nil {
+//       ...
+//   }
+//   logger := log.New(w, log.LOG_INFO, "myapp")
+//
+// The logger's prefix, without any process ID in brackets, is sent as
+// SYSLOG_IDENTIFIER, and the logger's facility, if set, as SYSLOG_FACILITY.
+// Fields attached with With() are sent with their keys
+// converted to upper case and any characters not allowed by journald replaced
+// by underscores.
+type JournalWriter struct {
+    conn *net.UnixConn
+    addr *net.UnixAddr
+    facility Facility
+}
+
+// Creates a JournalWriter connected to the journald socket.
+func NewJournalWriter() (*JournalWriter, error) {
+    return NewJournalWriterAddr(JournalSocket)
+}
+
+// Creates a JournalWriter that sends to the unix datagram socket at
+// socket_path instead of the standard journald socket. This is mostly useful
+// for testing.
+func NewJournalWriterAddr(socket_path string) (*JournalWriter, error) {
+    addr, err := net.ResolveUnixAddr("unixgram", socket_path)
+    if err != nil {
+        return nil, err
+    }
+
+    // The socket is left unconnected, since file descriptors can't be passed
+    // with WriteMsgUnix() on a connected datagram socket.
+    conn, err := net.ListenUnixgram("unixgram",
+        &net.UnixAddr{Name: "", Net: "unixgram"})
+    if err != nil {
+        return nil, err
+    }
+
+    w := new(JournalWriter)
+    w.conn = conn
+    w.addr = addr
+
+    return w, nil
+}
+
+// Sets the facility sent with records that don't have one. By default, no
+// facility is sent.
+func (w *JournalWriter) SetFacility(f Facility) {
+    w.facility = f
+}
+
+// Sends a record to the journal.
+func (w *JournalWriter) WriteRecord(rec *Record) error {
+    buf := new(bytes.Buffer)
+
+    journal_field(buf, "MESSAGE", rec.Message)
+
+    sev := rec.Severity
+    if !rec.HasSeverity() {
+        sev = LOG_INFO
+    }
+    journal_field(buf, "PRIORITY", strconv.Itoa(int(sev)))
+
+    facility := w.facility
+    if rec.HasFacility() {
+        facility = rec.Facility
+    }
+    if facility > LOG_KERN {
+        journal_field(buf, "SYSLOG_FACILITY", strconv.Itoa(int(facility >> 3)))
+    }
+
+    if ident := journal_identifier(rec.Prefix); ident != "" {
+        journal_field(buf, "SYSLOG_IDENTIFIER", ident)
+    }
+    if rec.Name != "" {
+        journal_field(buf, "LOGGER", rec.Name)
+    }
+
+    if rec.File != "" {
+        journal_field(buf, "CODE_FILE", rec.File)
+        journal_field(buf, "CODE_LINE", strconv.Itoa(rec.Line))
+    }
+    if rec.Func != "" {
+        journal_field(buf, "CODE_FUNC", rec.Func)
+    }
+
+    for _, field := range rec.Fields {
+        journal_field(buf, journal_field_name(field.Key),
+            field_string(field.Value))
+    }
+
+    return w.send(buf.Bytes())
+}
+
+// Sends b to the journal as a message with severity LOG_INFO.
+func (w *JournalWriter) Write(b []byte) (int, error) {
+    buf := new(bytes.Buffer)
+    journal_field(buf, "MESSAGE", strings.TrimSuffix(string(b), "\n"))
+    journal_field(buf, "PRIORITY", strconv.Itoa(int(LOG_INFO)))
+    if w.facility > LOG_KERN {
+        journal_field(buf, "SYSLOG_FACILITY",
+            strconv.Itoa(int(w.facility >> 3)))
+    }
+
+    if err := w.send(buf.Bytes()); err != nil {
+        return 0, err
+    }
+
+    return len(b), nil
+}
+
+// Closes the connection to the journal.
+func (w *JournalWriter) Close() error {
+    return w.conn.Close()
+}
+
+func (w *JournalWriter) send(data []byte) error {
+    _, _, err := w.conn.WriteMsgUnix(data, nil, w.addr)
+    if err == nil {
+        return nil
+    }
+
+    if !is_msg_too_big(err) {
+        return err
+    }
+
+    // The message is too large for a datagram, so pass it to journald in a
+    // file descriptor instead. journald accepts unlinked files in /dev/shm or
+    // /tmp for this, as well as sealed memfds.
+    return w.send_via_file(data)
+}
+
+func (w *JournalWriter) send_via_file(data []byte) error {
+    fh, err := ioutil.TempFile("/dev/shm", "go-log-journal-")
+    if err != nil {
+        fh, err = ioutil.TempFile(os.TempDir(), "go-log-journal-")
+        if err != nil {
+            return fmt.Errorf("Couldn't create temp file for journal: %s",
+                err)
+        }
+    }
+    defer fh.Close()
+
+    if err := os.Remove(fh.Name()); err != nil {
+        return err
+    }
+    if _, err := fh.Write(data); err != nil {
+        return err
+    }
+
+    rights := syscall.UnixRights(int(fh.Fd()))
+    _, _, err = w.conn.WriteMsgUnix(nil, rights, w.addr)
+
+    return err
+}
+
+func is_msg_too_big(err error) bool {
+    if op_err, ok := err.(*net.OpError); ok {
+        err = op_err.Err
+    }
+    if sys_err, ok := err.(*os.SyscallError); ok {
+        err = sys_err.Err
+    }
+
+    return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
+
+// Writes a field in the journal native protocol. Values containing a newline
+// are written in the binary form, with a 64-bit little-endian length.
+func journal_field(buf *bytes.Buffer, key, val string) {
+    buf.WriteString(key)
+    if strings.IndexByte(val, '\n') < 0 {
+        buf.WriteByte('=')
+        buf.WriteString(val)
+        buf.WriteByte('\n')
+        return
+    }
+
+    buf.WriteByte('\n')
+    binary.Write(buf, binary.LittleEndian, uint64(len(val)))
+    buf.WriteString(val)
+    buf.WriteByte('\n')
+}
+
+// Converts a field key to a valid journal field name: upper case letters,
+// digits, and underscores, not starting with an underscore or digit, and at
+// most 64 characters.
+func journal_field_name(key string) string {
+    name := []byte(strings.ToUpper(key))
+    for i, c := range name {
+        if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+            name[i] = '_'
+        }
+    }
+
+    s := strings.TrimLeft(string(name), "_")
+    if s == "" || (s[0] >= '0' && s[0] <= '9') {
+        s = "FIELD_" + s
+    }
+    if len(s) > 64 {
+        s = s[:64]
+    }
+
+    return s
+}
+
+// Extracts the identifier from a prefix, e.g., "myapp" from "myapp [123] ".
+func journal_identifier(prefix string) string {
+    ident := strings.TrimSpace(prefix)
+    if idx := strings.Index(ident, " ["); idx >= 0 {
+        ident = ident[:idx]
+    }
+
+    return strings.TrimRight(ident, ":")
+}
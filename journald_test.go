@@ -0,0 +1,206 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+//go:build linux
+// +build linux
+
+package log_test
+
+import (
+    "bytes"
+    "encoding/binary"
+    log "github.com/cuberat/go-log"
+    "io/ioutil"
+    "net"
+    "os"
+    "path/filepath"
+    "strings"
+    "syscall"
+    "testing"
+)
+
+// Stands in for journald, listening on a unix datagram socket in a temp dir.
+type JournalListener struct {
+    Conn *net.UnixConn
+    Path string
+    dir string
+}
+
+func NewJournalListener(t *testing.T) *JournalListener {
+    dir, err := ioutil.TempDir("", "go-log-journal")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+
+    jl := &JournalListener{Path: filepath.Join(dir, "socket"), dir: dir}
+    addr := &net.UnixAddr{Name: jl.Path, Net: "unixgram"}
+    jl.Conn, err = net.ListenUnixgram("unixgram", addr)
+    if err != nil {
+        os.RemoveAll(dir)
+        t.Fatalf("couldn't listen on %s: %s", jl.Path, err)
+    }
+
+    return jl
+}
+
+func (jl *JournalListener) Close() {
+    jl.Conn.Close()
+    os.RemoveAll(jl.dir)
+}
+
+// Reads one message, following a passed file descriptor if there is one, and
+// parses it into fields.
+func (jl *JournalListener) Read(t *testing.T) map[string]string {
+    buf := make([]byte, 65536)
+    oob := make([]byte, 1024)
+    n, oobn, _, _, err := jl.Conn.ReadMsgUnix(buf, oob)
+    if err != nil {
+        t.Fatalf("couldn't read from journal socket: %s", err)
+    }
+    data := buf[:n]
+
+    if oobn > 0 {
+        msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+        if err != nil || len(msgs) != 1 {
+            t.Fatalf("couldn't parse control message: %v", err)
+        }
+        fds, err := syscall.ParseUnixRights(&msgs[0])
+        if err != nil || len(fds) != 1 {
+            t.Fatalf("couldn't parse unix rights: %v", err)
+        }
+        fh := os.NewFile(uintptr(fds[0]), "journal-fd")
+        defer fh.Close()
+        fh.Seek(0, 0)
+        data, err = ioutil.ReadAll(fh)
+        if err != nil {
+            t.Fatalf("couldn't read passed file: %s", err)
+        }
+    }
+
+    return parse_journal_fields(t, data)
+}
+
+func parse_journal_fields(t *testing.T, data []byte) map[string]string {
+    fields := make(map[string]string)
+    for len(data) > 0 {
+        nl := bytes.IndexByte(data, '\n')
+        if nl < 0 {
+            t.Fatalf("unterminated journal field: %q", data)
+        }
+        line := string(data[:nl])
+        data = data[nl + 1:]
+
+        if eq := strings.IndexByte(line, '='); eq >= 0 {
+            fields[line[:eq]] = line[eq + 1:]
+            continue
+        }
+
+        size := binary.LittleEndian.Uint64(data[:8])
+        fields[line] = string(data[8:8 + size])
+        data = data[8 + size + 1:]
+    }
+
+    return fields
+}
+
+func TestJournalWriter(t *testing.T) {
+    jl := NewJournalListener(t)
+    defer jl.Close()
+
+    w, err := log.NewJournalWriterAddr(jl.Path)
+    if err != nil {
+        t.Fatalf("couldn't create journal writer: %s", err)
+    }
+    defer w.Close()
+
+    base_logger := log.New(w, log.LOG_DEBUG, "myapp [123] ")
+    base_logger.SetFacility(log.LOG_LOCAL6)
+    logger := base_logger.Named("db").With(
+        "user.id", 42, "query", "select 1\nfrom dual")
+
+    logger.Err("query failed")
+    fields := jl.Read(t)
+
+    expected := map[string]string{
+        "MESSAGE": "query failed",
+        "PRIORITY": "3",
+        "SYSLOG_FACILITY": "22",
+        "SYSLOG_IDENTIFIER": "myapp",
+        "LOGGER": "db",
+        "CODE_FUNC": "github.com/cuberat/go-log_test.TestJournalWriter",
+        "USER_ID": "42",
+        "QUERY": "select 1\nfrom dual",
+    }
+    for key, val := range expected {
+        if fields[key] != val {
+            t.Errorf("field %s: got %q, expected %q", key, fields[key], val)
+        }
+    }
+    if !strings.HasSuffix(fields["CODE_FILE"], "journald_test.go") {
+        t.Errorf("unexpected CODE_FILE %q", fields["CODE_FILE"])
+    }
+    if fields["CODE_LINE"] == "" {
+        t.Errorf("missing CODE_LINE")
+    }
+
+    logger.Print("no severity")
+    fields = jl.Read(t)
+    if fields["PRIORITY"] != "6" {
+        t.Errorf("expected PRIORITY 6 for Print(), got %q", fields["PRIORITY"])
+    }
+
+    base_logger.SetFacility(log.LOG_KERN)
+    w.SetFacility(log.LOG_DAEMON)
+    logger.Info("default facility")
+    fields = jl.Read(t)
+    if fields["SYSLOG_FACILITY"] != "3" {
+        t.Errorf("expected SYSLOG_FACILITY 3, got %q",
+            fields["SYSLOG_FACILITY"])
+    }
+}
+
+func TestJournalWriterOversized(t *testing.T) {
+    jl := NewJournalListener(t)
+    defer jl.Close()
+
+    w, err := log.NewJournalWriterAddr(jl.Path)
+    if err != nil {
+        t.Fatalf("couldn't create journal writer: %s", err)
+    }
+    defer w.Close()
+
+    logger := log.New(w, log.LOG_DEBUG, "")
+    big_msg := strings.Repeat("x", 4 << 20)
+    if err := logger.Info(big_msg); err != nil {
+        t.Fatalf("couldn't log oversized message: %s", err)
+    }
+
+    fields := jl.Read(t)
+    if fields["MESSAGE"] != big_msg {
+        t.Errorf("oversized message was not passed intact (got %d bytes)",
+            len(fields["MESSAGE"]))
+    }
+}
@@ -28,6 +28,9 @@
 // io.Writer looks like syslog, then certain parts of the log line will not be
 // generated, as syslog is expected to cover those.
 //
+// If the io.Writer implements the RecordWriter interface, as JournalWriter
+// does, each message is instead passed to it with its metadata as a Record.
+//
 // This logger looks like syslog, in that it allows for specifying severities
 // when logging. Unlike syslog, however, instead of setting a default severity
 // for logging, a severity threshold is specified at logger creation time that
@@ -40,7 +43,8 @@
 //
 // You may create a new logger using New() or NewFromFile(), or, if you want to
 // use the default logger, just call methods directly on the package, which will
-// write to os.Stderr.
+// write to os.Stderr. NewFromConfig() creates a logger from a Config, which may
+// be loaded from a JSON file or from GO_LOG_* environment variables.
 //
 // A Logger can be used simultaneously from multiple goroutines; it guarantees
 // to serialize access to the Writer.
@@ -48,11 +52,31 @@
 // The interface for this logging package is in an alpha state. That is, it may
 // have some non backward compatible changes in upcoming minor releases.
 //
+// Upgrading: a TimestampFunc is now passed the time of the log record, already
+// converted to the logger's time location (see SetTimeLocation()), instead of
+// taking no arguments. Timestamp functions written for earlier versions need
+// the new signature:
+//
+//   // Before:
+//   logger.SetTimestampFunc(func() string {
+//       return time.Now().Format(time.Stamp)
+//   })
+//
+//   // Now:
+//   logger.SetTimestampFunc(func(t time.Time) string {
+//       return t.Format(time.Stamp)
+//   })
+//
+//   // Or use one of the ready-made generators:
+//   logger.SetTimestampFunc(log.TimestampLayout(time.Stamp))
+//   logger.SetTimestampFunc(log.TimestampRFC3339Milli)
+//
 // Installation:
 //   go get github.com/cuberat/go-log
 package log
 
 import (
+    "context"
     "fmt"
     "io"
     "os"
@@ -95,8 +119,11 @@ type SyslogLike interface {
     Write(b []byte) (int, error)
 }
 
-// Timestamp generator function type.
-type TimestampFunc func() (string)
+// Timestamp generator function type. It is passed the time of the log record,
+// already converted to the logger's time location (see SetTimeLocation()), so
+// every output of a record carries the same timestamp. See timestamp.go for
+// ready-made implementations.
+type TimestampFunc func(t time.Time) (string)
 
 // Sets up stuff at package initialization time.
 func init() {
@@ -156,7 +183,143 @@ func SetTimestampFunc(f TimestampFunc) {
     default_logger.SetTimestampFunc(f)
 }
 
-// Sets the timestamp generation function.
+// Sets the time zone in which timestamps are generated for the default logger.
+func SetTimeLocation(loc *time.Location) {
+    default_logger.SetTimeLocation(loc)
+}
+
+// Sets the format of log lines for the default logger.
+func SetFormat(f Format) {
+    default_logger.SetFormat(f)
+}
+
+// Sets how messages containing newlines are written by the default logger.
+func SetMultilinePolicy(policy MultilinePolicy) {
+    default_logger.SetMultilinePolicy(policy)
+}
+
+// Sets the severity label style for the default logger. See
+// Logger.SetSeverityLabel() for details.
+func SetSeverityLabel(style SeverityLabel) {
+    default_logger.SetSeverityLabel(style)
+}
+
+// Returns an io.Writer that logs to the default logger with severity sev. See
+// Logger.SeverityWriter() for details.
+func SeverityWriter(sev Severity) io.Writer {
+    return default_logger.SeverityWriter(sev)
+}
+
+// Sets the output flags for the default logger. See Logger.SetFlags() for
+// details.
+func SetFlags(flag int) {
+    default_logger.SetFlags(flag)
+}
+
+// Returns the output flags for the default logger.
+func Flags() int {
+    return default_logger.Flags()
+}
+
+// Returns the prefix for the default logger.
+func Prefix() string {
+    return default_logger.Prefix()
+}
+
+// Returns the Writer the default logger writes to.
+func Writer() io.Writer {
+    return default_logger.Writer()
+}
+
+// Writes a message without a severity with the default logger. See
+// Logger.Output() for details.
+func Output(call_depth int, s string) error {
+    return default_logger.emit(call_depth, sev_none, s)
+}
+
+// Sets the TraceExtractor for the default logger. See
+// Logger.SetTraceExtractor() for details.
+func SetTraceExtractor(f TraceExtractor) {
+    default_logger.SetTraceExtractor(f)
+}
+
+// Returns a child of the default logger that adds the trace and span IDs found
+// in ctx to every record. See Logger.WithContext() for details.
+func WithContext(ctx context.Context) *Logger {
+    return default_logger.WithContext(ctx)
+}
+
+// Sets the Redactor for the default logger. See Logger.SetRedactor() for
+// details.
+func SetRedactor(r *Redactor) {
+    default_logger.SetRedactor(r)
+}
+
+// Publishes the default logger's Stats through expvar under the given name.
+// See Logger.PublishStats() for details.
+func PublishStats(name string) error {
+    return default_logger.PublishStats(name)
+}
+
+// Turns on the flight recorder for the default logger. See
+// Logger.SetFlightRecorder() for details.
+func SetFlightRecorder(size int, trigger Severity) {
+    default_logger.SetFlightRecorder(size, trigger)
+}
+
+// Writes the messages kept by the default logger's flight recorder to w. See
+// Logger.DumpRecent() for details.
+func DumpRecent(w io.Writer) error {
+    return default_logger.DumpRecent(w)
+}
+
+// Sets the error handler of the default logger. See Logger.SetErrorHandler()
+// for details.
+func SetErrorHandler(h ErrorHandler) {
+    default_logger.SetErrorHandler(h)
+}
+
+// Sets the fallback writer of the default logger. See
+// Logger.SetFallbackWriter() for details.
+func SetFallbackWriter(w io.Writer) {
+    default_logger.SetFallbackWriter(w)
+}
+
+// Turns on the circuit breaker for the default logger. See
+// Logger.SetCircuitBreaker() for details.
+func SetCircuitBreaker(max_failures int, retry time.Duration) {
+    default_logger.SetCircuitBreaker(max_failures, retry)
+}
+
+// Sets the exit function of the default logger. See Logger.SetExitFunc() for
+// details.
+func SetExitFunc(f func(code int)) {
+    default_logger.SetExitFunc(f)
+}
+
+// Sets the exit code of the default logger. See Logger.SetExitCode() for
+// details.
+func SetExitCode(code int) {
+    default_logger.SetExitCode(code)
+}
+
+// Registers a function to be called before the default logger exits. See
+// Logger.OnExit() for details.
+func OnExit(f func()) {
+    default_logger.OnExit(f)
+}
+
+// Sets the syslog facility for the default logger. See Logger.SetFacility()
+// for details.
+func SetFacility(f Facility) {
+    default_logger.SetFacility(f)
+}
+
+// Sets per-module severity thresholds for the default logger. See
+// Logger.SetModuleSeverityThresholds() for details.
+func SetModuleSeverityThresholds(levels map[string]Severity) {
+    default_logger.SetModuleSeverityThresholds(levels)
+}
 
 // Creates a logger from an io.Writer, with the given severity threshold and
 // prefix string.
@@ -166,12 +329,16 @@ func New(w io.Writer, sev_thresh Severity, prefix string) (*Logger) {
     }
 
     l := new(Logger)
+    l.core = new(logger_core)
     l.SetTimestampFunc(default_ts_func)
+    l.SetTimeLocation(time.UTC)
     l.set_output(w)
     l.SetSeverityThreshold(sev_thresh)
     l.SetPrefix(prefix)
 
-    l.lock_chan = make(chan bool, 1)
+    l.core.stats = new(logger_stats)
+    l.core.exit = &exit_state{code: 1}
+    l.core.flags = default_flags
 
     return l
 }
@@ -180,16 +347,18 @@ func New(w io.Writer, sev_thresh Severity, prefix string) (*Logger) {
 // severity threshold and prefix string
 func NewFromFile(file_path string, sev_thresh Severity, prefix string) (*Logger,
     error) {
-    fh, err := os.OpenFile(file_path, os.O_APPEND|os.O_CREATE, 0644)
+    fh, err := os.OpenFile(file_path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
     if err != nil {
         return nil, err
     }
 
-    return New(fh, sev_thresh, prefix), nil
+    l := New(fh, sev_thresh, prefix)
+    l.core.exit.closer = fh
+
+    return l, nil
 }
 
-func default_ts_func() string {
-    t := time.Now().UTC()
+func default_ts_func(t time.Time) string {
     return t.Format(time.RFC3339)
 }
 
@@ -281,55 +450,57 @@ func Warningf(format string, v ...interface{}) error {
     return default_logger.log_sevf(1, LOG_WARNING, format, v...)
 }
 
-// Equivalent to Print() followed by a call to os.Exit(1).
+// Logs a message with severity LOG_CRIT with the default logger and exits.
+// See Logger.Fatal() for details.
 func Fatal(v ...interface{}) {
-    default_logger.outputv(1, v...)
-    os.Exit(1)
+    default_logger.log_always(1, LOG_CRIT, sprint(v...))
+    default_logger.exit()
 }
 
-// Equivalent to Printf() followed by a call to os.Exit(1).
+// Equivalent to Fatal(), with arguments handled in the manner of fmt.Printf.
 func Fatalf(format string, v ...interface{}) {
-    default_logger.outputf(1, format, v...)
-    os.Exit(1)
+    default_logger.log_always(1, LOG_CRIT, sprintf(format, v...))
+    default_logger.exit()
 }
 
-// Equivalent to Println() followed by a call to os.Exit(1).
+// Equivalent to Fatal(), with arguments handled in the manner of fmt.Println.
 func Fatalln(v ...interface{}) {
-    default_logger.outputlnv(1, v...)
-    os.Exit(1)
+    default_logger.log_always(1, LOG_CRIT, sprintln(v...))
+    default_logger.exit()
 }
 
-// Equivalent to Print() followed by a call to panic().
+// Logs a message with severity LOG_EMERG with the default logger and panics.
+// See Logger.Panic() for details.
 func Panic(v ...interface{}) {
-    default_logger.outputv(1, v...)
+    default_logger.log_always(1, LOG_EMERG, sprint(v...))
     panic(fmt.Sprint(v...))
 }
 
-// Equivalent to Printf() followed by a call to panic().
+// Equivalent to Panic(), with arguments handled in the manner of fmt.Printf.
 func Panicf(format string, v ...interface{}) {
-    default_logger.outputf(1, format, v...)
+    default_logger.log_always(1, LOG_EMERG, sprintf(format, v...))
     panic(fmt.Sprintf(format, v...))
 }
 
-// Equivalent to Println() followed by a call to panic().
+// Equivalent to Panic(), with arguments handled in the manner of fmt.Println.
 func Panicln(v ...interface{}) {
-    default_logger.outputlnv(1, v...)
+    default_logger.log_always(1, LOG_EMERG, sprintln(v...))
     panic(fmt.Sprintln(v...))
 }
 
 // Prints to the logger. Arguments are handled in the manner of fmt.Print.
 func Print(v ...interface{}) error {
-    return default_logger.outputv(1, v...)
+    return default_logger.emit(1, sev_none, sprint(v...))
 }
 
 // Prints to the logger. Arguments are handled in the manner of fmt.Printf.
 func Printf(format string, v ...interface{}) error {
-    return default_logger.outputf(1, format, v...)
+    return default_logger.emit(1, sev_none, sprintf(format, v...))
 }
 
 // Prints to the logger. Arguments are handled in the manner of fmt.Println.
 func Println(v ...interface{}) error {
-    return default_logger.outputlnv(1, v...)
+    return default_logger.emit(1, sev_none, sprintln(v...))
 }
 
 // Returns an error like `fmt.Errorf`, but prepended with the source file name
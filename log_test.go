@@ -680,3 +680,50 @@ func TestSourceMethod(t *testing.T) {
         }
     })
 }
+
+func TestNamed(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_WARNING, "myapp [123] ")
+    logger.SetTimestampFunc(nil)
+
+    db := logger.Named("db")
+    pool := db.Named("pool")
+    if pool.Name() != "db.pool" {
+        t.Errorf("expected name \"db.pool\", got %q", pool.Name())
+    }
+
+    pool.Warning("pool warning")
+    if !strings.HasPrefix(buffer.String(), "myapp [123] db.pool: log_test.go:") {
+        t.Errorf("unexpected output from named logger: %q", buffer.String())
+    }
+
+    // Override on db is inherited by pool, but not by the parent.
+    buffer.Reset()
+    db.SetSeverityThreshold(log.LOG_DEBUG)
+    pool.Debug("pool debug")
+    logger.Debug("root debug")
+    output := buffer.String()
+    if !strings.Contains(output, "pool debug") {
+        t.Errorf("child should inherit threshold override: %q", output)
+    }
+    if strings.Contains(output, "root debug") {
+        t.Errorf("parent should not be affected by child threshold: %q",
+            output)
+    }
+
+    // Clearing the override falls back to the root's threshold.
+    buffer.Reset()
+    db.ClearSeverityThreshold()
+    pool.Info("pool info")
+    if buffer.Len() != 0 {
+        t.Errorf("child should inherit root threshold: %q", buffer.String())
+    }
+
+    // Children share the parent's writer.
+    other := new(bytes.Buffer)
+    logger.SetOutput(other)
+    pool.Err("pool err")
+    if !strings.Contains(other.String(), "pool err") {
+        t.Errorf("child should share parent's writer: %q", other.String())
+    }
+}
@@ -27,12 +27,17 @@
 package log
 
 import (
+    "bytes"
     "fmt"
     "io"
     "os"
     "path"
     "runtime"
+    "sort"
+    "strconv"
     "strings"
+    "sync"
+    "time"
 )
 
 // A Logger represents an active logging object that generates lines of output
@@ -40,13 +45,46 @@ import (
 // Write method or to the Writer's severity-related method, if it implements the
 // SyslogLike interface. A Logger can be used simultaneously from multiple
 // goroutines; it guarantees to serialize access to the Writer.
+//
+// Child loggers created with Named() share the Writer, the lock, and all
+// settings other than the severity threshold with the logger they were created
+// from.
 type Logger struct {
+    core *logger_core
+    parent *Logger
+    name string
+    fields []Field
     severity_thresh Severity
+    has_thresh bool
+}
+
+// State shared by a logger and all of its named descendants.
+type logger_core struct {
     writer io.Writer
     ts_func TimestampFunc
+    ts_location *time.Location
     prefix string
-    lock_chan chan bool
+    lock sync.Mutex
     syslog_writer SyslogLike
+    record_writer RecordWriter
+    format Format
+    multiline MultilinePolicy
+    label SeverityLabel
+    flags int
+    trace_extractor TraceExtractor
+    redactor *Redactor
+    stats *logger_stats
+    recorder *flight_recorder
+    exit_func func(code int)
+    exit *exit_state
+    facility Facility
+    module_levels []*module_level
+    guard write_guard
+}
+
+type module_level struct {
+    pattern string
+    sev Severity
 }
 
 const (
@@ -54,11 +92,13 @@ const (
 )
 
 func (l *Logger) set_output(w io.Writer) {
-    l.writer = w
-    if sysl, ok := w.(SyslogLike); ok {
-        l.syslog_writer = sysl
-    } else {
-        l.syslog_writer = nil
+    l.core.writer = w
+    l.core.syslog_writer = nil
+    l.core.record_writer = nil
+    if rw, ok := w.(RecordWriter); ok {
+        l.core.record_writer = rw
+    } else if sysl, ok := w.(SyslogLike); ok {
+        l.core.syslog_writer = sysl
     }
 }
 
@@ -68,9 +108,56 @@ func (l *Logger) SetOutput(w io.Writer) {
 }
 
 // Sets the severity threshold. Anything less important (further down the list
-// of severities) will not be logged.
+// of severities) will not be logged. On a child logger created with Named(),
+// this overrides the threshold inherited from its parent, for the child and
+// any of its own descendants that do not set a threshold themselves.
 func (l *Logger) SetSeverityThreshold(sev_thresh Severity) {
     l.severity_thresh = sev_thresh
+    l.has_thresh = true
+}
+
+// Removes a severity threshold override set on a child logger, so that it
+// inherits its parent's threshold again. This has no effect on a logger that
+// was not created with Named().
+func (l *Logger) ClearSeverityThreshold() {
+    if l.parent != nil {
+        l.has_thresh = false
+    }
+}
+
+// Returns the severity threshold in effect for this logger.
+func (l *Logger) SeverityThreshold() Severity {
+    for n := l; n != nil; n = n.parent {
+        if n.has_thresh {
+            return n.severity_thresh
+        }
+    }
+
+    return l.severity_thresh
+}
+
+// Creates a child logger that shares this logger's Writer, lock, and settings,
+// but appends name to its name, separated by a dot. The name is output after
+// the prefix, e.g., "myapp [123] db.pool: ". The child inherits the severity
+// threshold of its parent unless it is given its own with
+// SetSeverityThreshold().
+func (l *Logger) Named(name string) *Logger {
+    child := new(Logger)
+    child.core = l.core
+    child.parent = l
+    child.fields = l.fields
+    child.name = name
+    if l.name != "" {
+        child.name = l.name + "." + name
+    }
+
+    return child
+}
+
+// Returns the dot-separated name of the logger, or an empty string if it was
+// not created with Named().
+func (l *Logger) Name() string {
+    return l.name
 }
 
 // Sets the prefix to add to the beginning of each log line (after the
@@ -79,281 +166,255 @@ func (l *Logger) SetPrefix(prefix string) {
     if prefix == "" {
         prefix = fmt.Sprintf("%s [%d] ", path.Base(os.Args[0]), os.Getpid())
     }
-    l.prefix = prefix
+    l.core.prefix = prefix
 }
 
 // Sets the timestamp generator function. This will be called to generate the
-// timestamp for each log line.
+// timestamp for each log line. If f is nil, no timestamp is output.
 func (l *Logger) SetTimestampFunc(f TimestampFunc) {
-    l.ts_func = f
+    l.core.ts_func = f
 }
 
-// Logs a message with severity LOG_ALERT.
-func (l *Logger) Alert(m string) error {
-    if l.severity_thresh < LOG_ALERT {
-        return nil
+// Sets the time zone in which timestamps are generated. The default is UTC.
+// Use time.Local for the local time zone.
+func (l *Logger) SetTimeLocation(loc *time.Location) {
+    if loc == nil {
+        loc = time.UTC
     }
-    if l.syslog_writer != nil {
-        return l.out_syslog(l.syslog_writer.Alert, 1, m)
+    l.core.ts_location = loc
+}
+
+// Sets the format of log lines written to the Writer. This has no effect if
+// the Writer implements the SyslogLike interface, since syslog does its own
+// framing of messages.
+func (l *Logger) SetFormat(f Format) {
+    l.core.format = f
+}
+
+// Sets how messages containing newlines are written, in FormatText and to
+// Writers that implement the SyslogLike interface. The default is
+// MultilineRaw. Other formats always escape newlines, and RecordWriters
+// receive the message as is.
+func (l *Logger) SetMultilinePolicy(policy MultilinePolicy) {
+    l.core.multiline = policy
+}
+
+// Sets how the severity of each message is shown in FormatText. Loggers
+// created with New() leave it out, for compatibility, and those created with
+// NewFromConfig() use LabelUpper. It is always left out when the Writer is
+// SyslogLike, as syslog records the severity itself.
+func (l *Logger) SetSeverityLabel(style SeverityLabel) {
+    l.core.label = style
+}
+
+// Returns an io.Writer that logs the text of each call to its Write method as
+// a message with severity sev, subject to the severity threshold. This lets
+// code that only knows how to write to an io.Writer log at a severity, e.g.,
+//
+//   server.ErrorLog = stdlog.New(logger.SeverityWriter(log.LOG_ERR), "", 0)
+func (l *Logger) SeverityWriter(sev Severity) io.Writer {
+    return &severity_writer{logger: l, sev: sev}
+}
+
+type severity_writer struct {
+    logger *Logger
+    sev Severity
+}
+
+func (w *severity_writer) Write(b []byte) (int, error) {
+    err := w.logger.log_sev(1, w.sev, string(b))
+
+    return len(b), err
+}
+
+// Sets the Redactor applied to every message and field value before it is
+// formatted and passed to the Writer, or to the Writer's syslog methods. Values
+// implementing Redactable are replaced even without a Redactor. Passing nil
+// removes the Redactor.
+func (l *Logger) SetRedactor(r *Redactor) {
+    l.core.redactor = r
+}
+
+// Sets per-module severity thresholds that override the logger's severity
+// threshold for messages logged from matching source files. The module for a
+// message is the base name of its source file without the ".go" extension
+// (e.g., "server" for server.go). Keys may be patterns in the syntax of
+// path.Match, e.g., "db_*". An exact match takes precedence over a pattern.
+// Passing a nil or empty map removes all module thresholds.
+func (l *Logger) SetModuleSeverityThresholds(levels map[string]Severity) {
+    patterns := make([]string, 0, len(levels))
+    for pattern := range levels {
+        patterns = append(patterns, pattern)
     }
+    sort.Strings(patterns)
 
-    return l.output(1, m)
+    module_levels := make([]*module_level, 0, len(patterns))
+    for _, pattern := range patterns {
+        module_levels = append(module_levels,
+            &module_level{pattern: pattern, sev: levels[pattern]})
+    }
+
+    l.core.module_levels = module_levels
+}
+
+// Logs a message with severity LOG_ALERT.
+func (l *Logger) Alert(m string) error {
+    return l.log_sev(1, LOG_ALERT, m)
 }
 
 // Logs a message with severity LOG_ALERT. Arguments are handled in the manner
 // of fmt.Printf.
 func (l *Logger) Alertf(format string, v ...interface{}) error {
-    if l.severity_thresh < LOG_ALERT {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslogf(l.syslog_writer.Alert, 1, format, v...)
-    }
-
-    return l.output(1, fmt.Sprintf(format, v...))
+    return l.log_sevf(1, LOG_ALERT, format, v...)
 }
 
 // Logs a message with severity LOG_CRIT.
 func (l *Logger) Crit(m string) error {
-    if l.severity_thresh < LOG_CRIT {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslog(l.syslog_writer.Crit, 1, m)
-    }
-    return l.output(1, m)
+    return l.log_sev(1, LOG_CRIT, m)
 }
 
 // Logs a message with severity LOG_CRIT. Arguments are handled in the manner of
 // fmt.Printf.
 func (l *Logger) Critf(format string, v ...interface{}) error {
-    if l.severity_thresh < LOG_CRIT {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslogf(l.syslog_writer.Crit, 1, format, v...)
-    }
-
-    return l.output(1, fmt.Sprintf(format, v...))
+    return l.log_sevf(1, LOG_CRIT, format, v...)
 }
 
 // Logs a message with severity LOG_DEBUG.
 func (l *Logger) Debug(m string) error {
-    if l.severity_thresh < LOG_DEBUG {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslog(l.syslog_writer.Debug, 1, m)
-    }
-    return l.output(1, m)
+    return l.log_sev(1, LOG_DEBUG, m)
 }
 
 // Logs a message with severity LOG_DEBUG. Arguments are handled in the manner
 // of fmt.Printf.
 func (l *Logger) Debugf(format string, v ...interface{}) error {
-    if l.severity_thresh < LOG_DEBUG {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslogf(l.syslog_writer.Debug, 1, format, v...)
-    }
-    return l.output(1, fmt.Sprintf(format, v...))
+    return l.log_sevf(1, LOG_DEBUG, format, v...)
 }
 
 // Logs a message with severity LOG_EMERG.
 func (l *Logger) Emerg(m string) error {
-    if l.severity_thresh < LOG_EMERG {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslog(l.syslog_writer.Emerg, 1, m)
-    }
-    return l.output(1, m)
+    return l.log_sev(1, LOG_EMERG, m)
 }
 
 // Logs a message with severity LOG_EMERG. Arguments are handled in the manner
 // of fmt.Printf.
 func (l *Logger) Emergf(format string, v ...interface{}) error {
-    if l.severity_thresh < LOG_EMERG {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslogf(l.syslog_writer.Emerg, 1, format, v...)
-    }
-
-    return l.output(1, fmt.Sprintf(format, v...))
+    return l.log_sevf(1, LOG_EMERG, format, v...)
 }
 
 // Logs a message with severity LOG_ERR.
 func (l *Logger) Err(m string) error {
-    if l.severity_thresh < LOG_ERR {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslog(l.syslog_writer.Err, 1, m)
-    }
-
-    return l.output(1, m)
+    return l.log_sev(1, LOG_ERR, m)
 }
 
 // Logs a message with severity LOG_ERR. Arguments are handled in the manner
 // of fmt.Printf.
 func (l *Logger) Errf(format string, v ...interface{}) error {
-    if l.severity_thresh < LOG_ERR {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslogf(l.syslog_writer.Err, 1, format, v...)
-    }
-
-    return l.output(1, fmt.Sprintf(format, v...))
+    return l.log_sevf(1, LOG_ERR, format, v...)
 }
 
 // Logs a message with severity LOG_INFO.
 func (l *Logger) Info(m string) error {
-    if l.severity_thresh < LOG_INFO {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslog(l.syslog_writer.Info, 1, m)
-    }
-
-    return l.output(1, m)
+    return l.log_sev(1, LOG_INFO, m)
 }
 
 // Logs a message with severity LOG_INFO. Arguments are handled in the manner
 // of fmt.Printf.
 func (l *Logger) Infof(format string, v ...interface{}) error {
-    if l.severity_thresh < LOG_INFO {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslogf(l.syslog_writer.Info, 1, format, v...)
-    }
-
-    return l.output(1, fmt.Sprintf(format, v...))
+    return l.log_sevf(1, LOG_INFO, format, v...)
 }
 
 // Logs a message with severity LOG_NOTICE.
 func (l *Logger) Notice(m string) error {
-    if l.severity_thresh < LOG_NOTICE {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslog(l.syslog_writer.Notice, 1, m)
-    }
-
-    return l.output(1, m)
+    return l.log_sev(1, LOG_NOTICE, m)
 }
 
 // Logs a message with severity LOG_NOTICE. Arguments are handled in the
 // manner of fmt.Printf.
 func (l *Logger) Noticef(format string, v ...interface{}) error {
-    if l.severity_thresh < LOG_NOTICE {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslogf(l.syslog_writer.Notice, 1, format, v...)
-    }
-
-    return l.output(1, fmt.Sprintf(format, v...))
+    return l.log_sevf(1, LOG_NOTICE, format, v...)
 }
 
 // Logs a message with severity LOG_WARNING.
 func (l *Logger) Warning(m string) error {
-    if l.severity_thresh < LOG_WARNING {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslog(l.syslog_writer.Warning, 1, m)
-    }
-
-    return l.output(1, m)
+    return l.log_sev(1, LOG_WARNING, m)
 }
 
 // Logs a message with severity LOG_WARNING. Arguments are handled in the
 // manner of fmt.Printf.
 func (l *Logger) Warningf(format string, v ...interface{}) error {
-    if l.severity_thresh < LOG_WARNING {
-        return nil
-    }
-    if l.syslog_writer != nil {
-        return l.out_syslogf(l.syslog_writer.Warning, 1, format, v...)
-    }
-
-    return l.output(1, fmt.Sprintf(format, v...))
+    return l.log_sevf(1, LOG_WARNING, format, v...)
 }
 
 // Writes a log message.
 func (l *Logger) Write(b []byte) (int, error) {
-    if l.syslog_writer != nil {
-        str := l.get_output(1, string(b), flag_is_syslog)
-        _, err := l.syslog_writer.Write([]byte(str))
-        return len(b), err
-    }
-
-    err := l.output(1, string(b))
+    err := l.emit(1, sev_none, string(b))
 
     return len(b), err
 }
 
 // func (l *Logger) Close() error {
-//     if closer, ok := l.writer.(io.Closer); ok {
+//     if closer, ok := l.core.writer.(io.Closer); ok {
 //         return closer.Close()
 //     }
 //
-//     return fmt.Errorf("don't know how to Close() a %T", l.writer)
+//     return fmt.Errorf("don't know how to Close() a %T", l.core.writer)
 // }
 
-// Equivalent to Print() followed by a call to os.Exit(1).
+// Logs a message with severity LOG_CRIT, regardless of the severity
+// threshold, and then exits. Arguments are handled in the manner of fmt.Print.
+// Before exiting, the hooks registered with OnExit() are run, the Writer is
+// flushed, and the file opened by NewFromFile() is closed. The exit function
+// and code can be changed with SetExitFunc() and SetExitCode().
 func (l *Logger) Fatal(v ...interface{}) {
-    default_logger.outputv(1, v...)
-    os.Exit(1)
+    l.log_always(1, LOG_CRIT, sprint(v...))
+    l.exit()
 }
 
-// Equivalent to Printf() followed by a call to os.Exit(1).
+// Equivalent to Fatal(), with arguments handled in the manner of fmt.Printf.
 func (l *Logger) Fatalf(format string, v ...interface{}) {
-    l.outputf(1, format, v...)
-    os.Exit(1)
+    l.log_always(1, LOG_CRIT, sprintf(format, v...))
+    l.exit()
 }
 
-// Equivalent to Println() followed by a call to os.Exit(1).
+// Equivalent to Fatal(), with arguments handled in the manner of fmt.Println.
 func (l *Logger) Fatalln(v ...interface{}) {
-    l.outputlnv(1, v...)
-    os.Exit(1)
+    l.log_always(1, LOG_CRIT, sprintln(v...))
+    l.exit()
 }
 
-// Equivalent to Print() followed by a call to panic().
+// Logs a message with severity LOG_EMERG, regardless of the severity
+// threshold, and then panics. Arguments are handled in the manner of
+// fmt.Print.
 func (l *Logger) Panic(v ...interface{}) {
-    l.outputv(1, v...)
+    l.log_always(1, LOG_EMERG, sprint(v...))
     panic(fmt.Sprint(v...))
 }
 
-// Equivalent to Printf() followed by a call to panic().
+// Equivalent to Panic(), with arguments handled in the manner of fmt.Printf.
 func (l *Logger) Panicf(format string, v ...interface{}) {
-    l.outputf(1, format, v...)
+    l.log_always(1, LOG_EMERG, sprintf(format, v...))
     panic(fmt.Sprintf(format, v...))
 }
 
-// Equivalent to Println() followed by a call to panic().
+// Equivalent to Panic(), with arguments handled in the manner of fmt.Println.
 func (l *Logger) Panicln(v ...interface{}) {
-    l.outputlnv(1, v...)
+    l.log_always(1, LOG_EMERG, sprintln(v...))
     panic(fmt.Sprintln(v...))
 }
 
 // Prints to the logger. Arguments are handled in the manner of fmt.Print.
 func (l *Logger) Print(v ...interface{}) error {
-    return l.outputv(1, v...)
+    return l.emit(1, sev_none, sprint(v...))
 }
 
 // Prints to the logger. Arguments are handled in the manner of fmt.Printf.
 func (l *Logger) Printf(format string, v ...interface{}) error {
-    return l.outputf(1, format, v...)
+    return l.emit(1, sev_none, sprintf(format, v...))
 }
 
 // Prints to the logger. Arguments are handled in the manner of fmt.Println.
 func (l *Logger) Println(v ...interface{}) error {
-    return l.outputlnv(1, v...)
+    return l.emit(1, sev_none, sprintln(v...))
 }
 
 // Returns an error like `fmt.Errorf`, but prepended with the source file name
@@ -380,105 +441,336 @@ func (l *Logger) ErrorfDepth(
 
 type syslog_func func(m string) error
 
-func (l *Logger) out_syslog(log_func syslog_func, call_depth int,
-    m string) error {
-
-    output := l.get_output(call_depth + 1, m, flag_is_syslog)
-
-    l.get_lock()
-    defer l.release_lock()
+// Implemented by RecordWriters in this package that send to syslog, e.g.,
+// SyslogWriter, so that the logger can format the message for syslog with its
+// own flags and multi-line policy, as it does for a SyslogLike writer.
+type syslog_record_writer interface {
+    write_syslog(rec *Record, m string) error
+}
+
+// Sends formatted output to a syslog function. With MultilineRepeatHeader,
+// each line is sent as a separate syslog message, as it would be written as a
+// separate line to a file.
+func (l *Logger) syslog_send(log_func syslog_func, output string) error {
+    if l.core.multiline != MultilineRepeatHeader {
+        err := log_func(output)
+        l.core.stats.count_syslog_write(output, err)
+        return err
+    }
+
+    lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+    for _, line := range lines {
+        err := log_func(line + "\n")
+        l.core.stats.count_syslog_write(line + "\n", err)
+        if err != nil {
+            return err
+        }
+    }
 
-    return log_func(output)
+    return nil
 }
 
-func (l *Logger) out_syslogf(log_func syslog_func, call_depth int,
-    format string, v ...interface{}) error {
+// Returns the method of the syslog writer for the given severity, or a
+// function calling its Write method if the message has no severity.
+func (l *Logger) syslog_func_for(sev Severity) syslog_func {
+    w := l.core.syslog_writer
+    switch sev {
+    case LOG_EMERG:
+        return w.Emerg
+    case LOG_ALERT:
+        return w.Alert
+    case LOG_CRIT:
+        return w.Crit
+    case LOG_ERR:
+        return w.Err
+    case LOG_WARNING:
+        return w.Warning
+    case LOG_NOTICE:
+        return w.Notice
+    case LOG_INFO:
+        return w.Info
+    case LOG_DEBUG:
+        return w.Debug
+    }
 
-    m := fmt.Sprintf(format, v...)
-    return l.out_syslog(log_func, call_depth + 1, m)
+    return func(m string) error {
+        _, err := w.Write([]byte(m))
+        return err
+    }
 }
 
+// Logs a message with severity sev, if it passes the threshold, for the
+// function call_depth frames above the caller. This is shared by the severity
+// methods and the package-level severity functions, so that both are handled
+// the same way.
 func (l *Logger) log_sev(call_depth int, sev Severity, m string) error {
-    if l.severity_thresh < sev {
-        return nil
+    if !l.enabled(call_depth + 1, sev) {
+        return l.record_recent(call_depth + 1, sev, m)
     }
 
-    return l.output(call_depth + 1, m)
+    return l.emit(call_depth + 1, sev, m)
 }
 
 func (l *Logger) log_sevf(call_depth int, sev Severity, format string,
     v ...interface{}) error {
 
-    if l.severity_thresh < sev {
-        return nil
+    if !l.enabled(call_depth + 1, sev) {
+        return l.record_recentf(call_depth + 1, sev, format, v...)
     }
 
-    return l.output(call_depth + 1, fmt.Sprintf(format, v...))
+    return l.emit(call_depth + 1, sev, sprintf(format, v...))
+}
+
+// Reports whether a message with the given severity, logged from the function
+// call_depth frames above the caller, should be output. If so, and the message
+// triggers the flight recorder, the recorded messages are written first.
+func (l *Logger) enabled(call_depth int, sev Severity) bool {
+    if l.passes_threshold(call_depth + 1, sev) {
+        l.flush_recent(sev)
+        return true
+    }
+    l.core.stats.count_suppressed(sev)
+
+    return false
+}
+
+func (l *Logger) passes_threshold(call_depth int, sev Severity) bool {
+    if len(l.core.module_levels) == 0 {
+        return sev <= l.SeverityThreshold()
+    }
+
+    _, file_name, _, ok := runtime.Caller(call_depth + 1)
+    if ok {
+        if thresh, found := l.module_threshold(file_name); found {
+            return sev <= thresh
+        }
+    }
+
+    return sev <= l.SeverityThreshold()
+}
+
+func (l *Logger) module_threshold(file_name string) (Severity, bool) {
+    module := strings.TrimSuffix(path.Base(file_name), ".go")
+    for _, ml := range l.core.module_levels {
+        if ml.pattern == module {
+            return ml.sev, true
+        }
+    }
+    for _, ml := range l.core.module_levels {
+        if matched, _ := path.Match(ml.pattern, module); matched {
+            return ml.sev, true
+        }
+    }
+
+    return Severity(0), false
 }
 
 func (l *Logger) get_lock() {
-    l.lock_chan <- true
+    l.core.lock.Lock()
 }
 
 func (l *Logger) release_lock() {
-    <-l.lock_chan
+    l.core.lock.Unlock()
 }
 
-func (l *Logger) get_output(call_depth int, s string, flags uint32) string {
-    parts := make([]string, 0, 4)
+func (l *Logger) new_record(call_depth int, sev Severity, s string) *Record {
+    l.core.stats.count_emitted(sev)
 
-    // Leave out the timestamp and prefix if the writer looks like syslog, since
-    // syslog will add these itself.
-    if (flags & flag_is_syslog) == 0 {
-        if l.ts_func != nil {
-        ts := l.ts_func()
-            parts = append(parts, ts + " ")
-        }
-        parts = append(parts, l.prefix)
+    return l.build_record(call_depth + 1, sev, s)
+}
+
+func (l *Logger) build_record(call_depth int, sev Severity,
+    s string) *Record {
+
+    rec := new(Record)
+    rec.Time = time.Now().In(l.core.ts_location)
+    rec.Severity = sev
+    rec.Prefix = l.core.prefix
+    rec.Facility = l.core.facility
+    rec.Name = l.name
+    rec.Message = l.core.redactor.Redact(strings.TrimSuffix(s, "\n"))
+    rec.Fields = l.core.redactor.redact_fields(l.fields)
+
+    if ci := caller_for(call_depth + 1); ci != nil {
+        rec.File = ci.file
+        rec.Line = ci.line
+        rec.Func = ci.function
+        rec.caller = ci
     }
 
-    _, file_name, line, _ := runtime.Caller(call_depth + 1)
-    source := fmt.Sprintf("%s:%d", path.Base(file_name), line)
-    parts = append(parts, source + ": ")
+    return rec
+}
 
-    if !strings.HasSuffix(s, "\n") {
-        s += "\n"
+// Source information for a call site.
+type caller_info struct {
+    file string
+    line int
+    function string
+    source string
+}
+
+// Caller information keyed by program counter, so that the file, function,
+// and source strings are only built once per call site.
+var caller_cache sync.Map
+
+// Returns the source information for the function call_depth frames above the
+// caller, or nil if there is none.
+func caller_for(call_depth int) *caller_info {
+    var pcs [1]uintptr
+    if runtime.Callers(call_depth + 2, pcs[:]) == 0 {
+        return nil
+    }
+    if ci, ok := caller_cache.Load(pcs[0]); ok {
+        return ci.(*caller_info)
     }
 
-    parts = append(parts, s)
+    frame, _ := runtime.CallersFrames(pcs[:]).Next()
+    ci := &caller_info{file: frame.File, line: frame.Line,
+        function: frame.Function,
+        source: path.Base(frame.File) + ":" + strconv.Itoa(frame.Line)}
+    caller_cache.Store(pcs[0], ci)
 
-    return strings.Join(parts, "")
+    return ci
 }
 
-func (l *Logger) output(call_depth int, s string) error {
-    return l.output_with_flags(call_depth + 1, s, 0)
+// Buffers for formatting lines, reused to avoid an allocation per message.
+var buffer_pool = sync.Pool{
+    New: func() interface{} {
+        return new(bytes.Buffer)
+    },
 }
 
-func (l *Logger) output_with_flags(call_depth int, s string,
-    flags uint32) error {
+// Buffers that grew larger than this, for unusually long messages, are not
+// kept in the pool.
+const max_pooled_buffer = 64 * 1024
 
-    out_str := l.get_output(call_depth + 1, s, flags)
+func get_buffer() *bytes.Buffer {
+    b := buffer_pool.Get().(*bytes.Buffer)
+    b.Reset()
 
-    l.get_lock()
-    defer l.release_lock()
+    return b
+}
 
-    _, err := fmt.Fprint(l.writer, out_str)
-    return err
+func put_buffer(b *bytes.Buffer) {
+    if b.Cap() <= max_pooled_buffer {
+        buffer_pool.Put(b)
+    }
 }
 
-func (l *Logger) outputv(call_depth int, v ...interface{}) error {
-    m := fmt.Sprint(v...)
-    return l.output_with_flags(call_depth + 1, m, 0)
+func (l *Logger) format_record(rec *Record, flags uint32) string {
+    b := get_buffer()
+    defer put_buffer(b)
+    l.write_formatted(b, rec, flags)
+
+    return b.String()
 }
 
-func (l *Logger) outputlnv(call_depth int, v ...interface{}) error {
-    m := fmt.Sprintln(v...)
-    return l.output_with_flags(call_depth + 1, m, 0)
+// Appends rec to b as it would be written to the Writer, or to the syslog
+// writer if flags includes flag_is_syslog.
+func (l *Logger) write_formatted(b *bytes.Buffer, rec *Record, flags uint32) {
+    // Leave out the timestamp and prefix if the writer looks like syslog, since
+    // syslog will add these itself.
+    if (flags & flag_is_syslog) != 0 {
+        write_text(b, &record{Record: rec,
+            multiline: l.core.multiline,
+            flags: l.core.flags | Ltimestamp, trace_sd: true})
+        return
+    }
+
+    fr := record{Record: rec, prefix: rec.Prefix,
+        multiline: l.core.multiline, label: l.core.label,
+        flags: l.core.flags}
+    if l.core.flags & Ltimestamp != 0 {
+        if l.core.ts_func != nil {
+            fr.ts = l.core.ts_func(rec.Time)
+        }
+    } else {
+        fr.ts = std_timestamp(rec.Time, l.core.flags)
+    }
+
+    l.core.format.write_record(b, &fr)
 }
 
-func (l *Logger) outputf(call_depth int, format string,
-    v ...interface{}) error {
+// Logs a message with the given severity, or without one if sev is sev_none.
+// All of the logging methods and package-level functions end up here once the
+// message has passed the severity threshold, so that every message is handled
+// the same way: it is passed to the RecordWriter, if there is one, or to the
+// syslog method for its severity, if the Writer is SyslogLike, or else written
+// to the Writer as a formatted line. If that fails, the message goes to the
+// fallback writer and the error handler, if any. See SetFallbackWriter().
+func (l *Logger) emit(call_depth int, sev Severity, s string) error {
+    return l.emit_record(l.new_record(call_depth + 1, sev, s))
+}
+
+func (l *Logger) emit_record(rec *Record) error {
+    b := get_buffer()
+    defer put_buffer(b)
+
+    var out_str string
+    _, syslog_rw := l.core.record_writer.(syslog_record_writer)
+    switch {
+    case syslog_rw:
+        out_str = l.format_record(rec, flag_is_syslog)
+    case l.core.record_writer != nil:
+    case l.core.syslog_writer != nil:
+        out_str = l.format_record(rec, flag_is_syslog)
+    default:
+        l.write_formatted(b, rec, 0)
+    }
+
+    l.get_lock()
+    g := &l.core.guard
+    err := ErrWriterUnavailable
+    if !g.is_open() {
+        err = l.write_locked(rec, b.Bytes(), out_str)
+    }
+    var missed, lost uint64
+    saved := false
+    if err == nil {
+        missed, lost = g.record_result(nil)
+    } else {
+        if err != ErrWriterUnavailable {
+            g.record_result(err)
+        }
+        saved = l.write_fallback(rec, b.Bytes())
+    }
+    handler := g.handler
+    l.release_lock()
+
+    if err != nil {
+        g.call_handler(handler, err, rec)
+        if saved {
+            return nil
+        }
+        return err
+    }
+    if missed > 0 {
+        l.report_recovery(rec, missed, lost)
+    }
+
+    return nil
+}
+
+// Writes rec to the RecordWriter, the syslog writer, or the Writer, given the
+// formatted line or syslog message. Must be called with the lock held.
+func (l *Logger) write_locked(rec *Record, line []byte, out_str string) error {
+    if srw, ok := l.core.record_writer.(syslog_record_writer); ok {
+        return l.syslog_send(func(m string) error {
+            return srw.write_syslog(rec, m)
+        }, out_str)
+    }
 
-    m := fmt.Sprintf(format, v...)
-    return l.output_with_flags(call_depth + 1, m, 0)
+    if l.core.record_writer != nil {
+        err := l.core.record_writer.WriteRecord(rec)
+        l.core.stats.count_write(0, err)
+        return err
+    }
+
+    if l.core.syslog_writer != nil {
+        return l.syslog_send(l.syslog_func_for(rec.Severity), out_str)
+    }
+
+    n, err := l.core.writer.Write(line)
+    l.core.stats.count_write(n, err)
+    return err
 }
@@ -0,0 +1,365 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "bufio"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "time"
+)
+
+// A minimal MessagePack encoder, sufficient for the Fluentd forward protocol.
+// See https://github.com/msgpack/msgpack/blob/master/spec.md.
+type msgpack_encoder struct {
+    buf []byte
+}
+
+func (e *msgpack_encoder) reset() {
+    e.buf = e.buf[:0]
+}
+
+func (e *msgpack_encoder) bytes() []byte {
+    return e.buf
+}
+
+func (e *msgpack_encoder) put_nil() {
+    e.buf = append(e.buf, 0xc0)
+}
+
+func (e *msgpack_encoder) put_bool(b bool) {
+    if b {
+        e.buf = append(e.buf, 0xc3)
+    } else {
+        e.buf = append(e.buf, 0xc2)
+    }
+}
+
+func (e *msgpack_encoder) put_int(i int64) {
+    switch {
+    case i >= 0:
+        e.put_uint(uint64(i))
+    case i >= -32:
+        e.buf = append(e.buf, byte(i))
+    case i >= math.MinInt8:
+        e.buf = append(e.buf, 0xd0, byte(i))
+    case i >= math.MinInt16:
+        e.buf = append(e.buf, 0xd1)
+        e.buf = append_uint16(e.buf, uint16(i))
+    case i >= math.MinInt32:
+        e.buf = append(e.buf, 0xd2)
+        e.buf = append_uint32(e.buf, uint32(i))
+    default:
+        e.buf = append(e.buf, 0xd3)
+        e.buf = append_uint64(e.buf, uint64(i))
+    }
+}
+
+func (e *msgpack_encoder) put_uint(u uint64) {
+    switch {
+    case u <= 0x7f:
+        e.buf = append(e.buf, byte(u))
+    case u <= math.MaxUint8:
+        e.buf = append(e.buf, 0xcc, byte(u))
+    case u <= math.MaxUint16:
+        e.buf = append(e.buf, 0xcd)
+        e.buf = append_uint16(e.buf, uint16(u))
+    case u <= math.MaxUint32:
+        e.buf = append(e.buf, 0xce)
+        e.buf = append_uint32(e.buf, uint32(u))
+    default:
+        e.buf = append(e.buf, 0xcf)
+        e.buf = append_uint64(e.buf, u)
+    }
+}
+
+func (e *msgpack_encoder) put_float(f float64) {
+    e.buf = append(e.buf, 0xcb)
+    e.buf = append_uint64(e.buf, math.Float64bits(f))
+}
+
+func (e *msgpack_encoder) put_string(s string) {
+    n := len(s)
+    switch {
+    case n <= 31:
+        e.buf = append(e.buf, 0xa0 | byte(n))
+    case n <= math.MaxUint8:
+        e.buf = append(e.buf, 0xd9, byte(n))
+    case n <= math.MaxUint16:
+        e.buf = append(e.buf, 0xda)
+        e.buf = append_uint16(e.buf, uint16(n))
+    default:
+        e.buf = append(e.buf, 0xdb)
+        e.buf = append_uint32(e.buf, uint32(n))
+    }
+    e.buf = append(e.buf, s...)
+}
+
+func (e *msgpack_encoder) put_bin(b []byte) {
+    n := len(b)
+    switch {
+    case n <= math.MaxUint8:
+        e.buf = append(e.buf, 0xc4, byte(n))
+    case n <= math.MaxUint16:
+        e.buf = append(e.buf, 0xc5)
+        e.buf = append_uint16(e.buf, uint16(n))
+    default:
+        e.buf = append(e.buf, 0xc6)
+        e.buf = append_uint32(e.buf, uint32(n))
+    }
+    e.buf = append(e.buf, b...)
+}
+
+func (e *msgpack_encoder) put_array_header(n int) {
+    switch {
+    case n <= 15:
+        e.buf = append(e.buf, 0x90 | byte(n))
+    case n <= math.MaxUint16:
+        e.buf = append(e.buf, 0xdc)
+        e.buf = append_uint16(e.buf, uint16(n))
+    default:
+        e.buf = append(e.buf, 0xdd)
+        e.buf = append_uint32(e.buf, uint32(n))
+    }
+}
+
+func (e *msgpack_encoder) put_map_header(n int) {
+    switch {
+    case n <= 15:
+        e.buf = append(e.buf, 0x80 | byte(n))
+    case n <= math.MaxUint16:
+        e.buf = append(e.buf, 0xde)
+        e.buf = append_uint16(e.buf, uint16(n))
+    default:
+        e.buf = append(e.buf, 0xdf)
+        e.buf = append_uint32(e.buf, uint32(n))
+    }
+}
+
+// Encodes the time as a Fluentd EventTime: ext type 0 with big-endian 32-bit
+// seconds and nanoseconds.
+func (e *msgpack_encoder) put_event_time(t time.Time) {
+    e.buf = append(e.buf, 0xd7, 0x00)
+    e.buf = append_uint32(e.buf, uint32(t.Unix()))
+    e.buf = append_uint32(e.buf, uint32(t.Nanosecond()))
+}
+
+// Encodes a field value. Strings, numbers, booleans, nil, and byte slices are
+// encoded natively; anything else is encoded as its string form.
+func (e *msgpack_encoder) put_value(v interface{}) {
+    switch val := v.(type) {
+    case nil:
+        e.put_nil()
+    case bool:
+        e.put_bool(val)
+    case string:
+        e.put_string(val)
+    case []byte:
+        e.put_bin(val)
+    case int:
+        e.put_int(int64(val))
+    case int8:
+        e.put_int(int64(val))
+    case int16:
+        e.put_int(int64(val))
+    case int32:
+        e.put_int(int64(val))
+    case int64:
+        e.put_int(val)
+    case uint:
+        e.put_uint(uint64(val))
+    case uint8:
+        e.put_uint(uint64(val))
+    case uint16:
+        e.put_uint(uint64(val))
+    case uint32:
+        e.put_uint(uint64(val))
+    case uint64:
+        e.put_uint(val)
+    case float32:
+        e.put_float(float64(val))
+    case float64:
+        e.put_float(val)
+    default:
+        e.put_string(field_string(v))
+    }
+}
+
+func append_uint16(b []byte, u uint16) []byte {
+    return append(b, byte(u >> 8), byte(u))
+}
+
+func append_uint32(b []byte, u uint32) []byte {
+    return append(b, byte(u >> 24), byte(u >> 16), byte(u >> 8), byte(u))
+}
+
+func append_uint64(b []byte, u uint64) []byte {
+    return append_uint32(append_uint32(b, uint32(u >> 32)), uint32(u))
+}
+
+// Reads a single MessagePack value from r. Maps are returned as
+// map[string]interface{} (non-string keys are converted with fmt.Sprint()),
+// arrays as []interface{}, integers as int64 or uint64, and extension values
+// as []byte with the type dropped. This is used to read acknowledgements from
+// Fluentd.
+func msgpack_read(r *bufio.Reader) (interface{}, error) {
+    c, err := r.ReadByte()
+    if err != nil {
+        return nil, err
+    }
+
+    switch {
+    case c <= 0x7f:
+        return int64(c), nil
+    case c >= 0xe0:
+        return int64(int8(c)), nil
+    case c & 0xe0 == 0xa0:
+        return msgpack_read_str(r, int(c & 0x1f))
+    case c & 0xf0 == 0x90:
+        return msgpack_read_array(r, int(c & 0x0f))
+    case c & 0xf0 == 0x80:
+        return msgpack_read_map(r, int(c & 0x0f))
+    }
+
+    switch c {
+    case 0xc0:
+        return nil, nil
+    case 0xc2:
+        return false, nil
+    case 0xc3:
+        return true, nil
+    case 0xcc, 0xcd, 0xce, 0xcf:
+        u, err := msgpack_read_uint(r, 1 << (c - 0xcc))
+        return u, err
+    case 0xd0, 0xd1, 0xd2, 0xd3:
+        size := 1 << (c - 0xd0)
+        u, err := msgpack_read_uint(r, size)
+        shift := uint(64 - 8 * size)
+        return int64(u << shift) >> shift, err
+    case 0xca:
+        u, err := msgpack_read_uint(r, 4)
+        return float64(math.Float32frombits(uint32(u))), err
+    case 0xcb:
+        u, err := msgpack_read_uint(r, 8)
+        return math.Float64frombits(u), err
+    case 0xd9, 0xda, 0xdb:
+        n, err := msgpack_read_uint(r, 1 << (c - 0xd9))
+        if err != nil {
+            return nil, err
+        }
+        return msgpack_read_str(r, int(n))
+    case 0xc4, 0xc5, 0xc6:
+        n, err := msgpack_read_uint(r, 1 << (c - 0xc4))
+        if err != nil {
+            return nil, err
+        }
+        return msgpack_read_bytes(r, int(n))
+    case 0xdc, 0xdd:
+        n, err := msgpack_read_uint(r, 2 << (c - 0xdc))
+        if err != nil {
+            return nil, err
+        }
+        return msgpack_read_array(r, int(n))
+    case 0xde, 0xdf:
+        n, err := msgpack_read_uint(r, 2 << (c - 0xde))
+        if err != nil {
+            return nil, err
+        }
+        return msgpack_read_map(r, int(n))
+    case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+        return msgpack_read_bytes(r, 1 + (1 << (c - 0xd4)))
+    case 0xc7, 0xc8, 0xc9:
+        n, err := msgpack_read_uint(r, 1 << (c - 0xc7))
+        if err != nil {
+            return nil, err
+        }
+        return msgpack_read_bytes(r, 1 + int(n))
+    }
+
+    return nil, fmt.Errorf("Invalid MessagePack type byte 0x%02x", c)
+}
+
+func msgpack_read_uint(r *bufio.Reader, size int) (uint64, error) {
+    b := make([]byte, 8)
+    if _, err := io.ReadFull(r, b[8 - size:]); err != nil {
+        return 0, err
+    }
+
+    return binary.BigEndian.Uint64(b), nil
+}
+
+func msgpack_read_bytes(r *bufio.Reader, n int) ([]byte, error) {
+    b := make([]byte, n)
+    if _, err := io.ReadFull(r, b); err != nil {
+        return nil, err
+    }
+
+    return b, nil
+}
+
+func msgpack_read_str(r *bufio.Reader, n int) (string, error) {
+    b, err := msgpack_read_bytes(r, n)
+    return string(b), err
+}
+
+func msgpack_read_array(r *bufio.Reader, n int) ([]interface{}, error) {
+    arr := make([]interface{}, 0, n)
+    for i := 0; i < n; i++ {
+        v, err := msgpack_read(r)
+        if err != nil {
+            return nil, err
+        }
+        arr = append(arr, v)
+    }
+
+    return arr, nil
+}
+
+func msgpack_read_map(r *bufio.Reader, n int) (map[string]interface{},
+    error) {
+
+    m := make(map[string]interface{}, n)
+    for i := 0; i < n; i++ {
+        k, err := msgpack_read(r)
+        if err != nil {
+            return nil, err
+        }
+        v, err := msgpack_read(r)
+        if err != nil {
+            return nil, err
+        }
+        if key, ok := k.(string); ok {
+            m[key] = v
+        } else {
+            m[fmt.Sprint(k)] = v
+        }
+    }
+
+    return m, nil
+}
@@ -0,0 +1,315 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "crypto/tls"
+    "fmt"
+    "math/rand"
+    "net"
+    "sync"
+    "time"
+)
+
+// Settings for a NetWriter. The zero value of each setting selects its
+// default.
+type NetWriterConfig struct {
+    // The TLS configuration for the "tls" network. Set Certificates to use a
+    // client certificate. If nil, a default configuration is used.
+    TLSConfig *tls.Config
+
+    // The delay before the first reconnection attempt, doubled after each
+    // failed attempt up to MaxBackoff. A random jitter of up to half the
+    // delay is subtracted from each delay. Defaults to 100ms and 30s.
+    MinBackoff time.Duration
+    MaxBackoff time.Duration
+
+    // The maximum number of writes buffered while disconnected. When the
+    // buffer is full, the oldest write is dropped. Defaults to 1000.
+    MaxBuffered int
+
+    // Timeouts for connecting and for each write. Default to 10s.
+    DialTimeout time.Duration
+    WriteTimeout time.Duration
+
+    // If set, called whenever the writer connects or disconnects. err is the
+    // error that caused a disconnection, and nil otherwise. It is called from
+    // the goroutine that detected the change, without holding any locks.
+    OnStateChange func(connected bool, err error)
+}
+
+// A NetWriter is an io.Writer that sends data over a TCP, TLS, or unix stream
+// connection that it owns. If the connection fails, the NetWriter reconnects in
+// the background with exponential backoff and jitter, buffering a bounded
+// number of writes in the meantime and sending them once reconnected. Pass it
+// to New() or SetOutput() to log to a remote collector that may restart.
+//
+// Each call to Write is buffered as a unit, so each buffered write is one log
+// line when used with a Logger. If a write fails after part of it was sent,
+// the rest is dropped rather than buffered, since the peer has already
+// received the start of the line on the old connection, and sending it again,
+// in full or in part, on the new one would only add another broken line.
+// Such writes are counted by Dropped().
+type NetWriter struct {
+    network string
+    addr string
+    config NetWriterConfig
+
+    lock sync.Mutex
+    conn net.Conn
+    buffer [][]byte
+    dropped uint64
+    reconnecting bool
+    closed bool
+    close_chan chan bool
+}
+
+// Creates a NetWriter sending to addr over network, which may be "tcp",
+// "tcp4", "tcp6", "tls", or "unix". The first connection is attempted
+// immediately; if it fails, the NetWriter keeps trying in the background, so
+// an error is only returned for an unsupported network. If config is nil, the
+// defaults are used.
+func NewNetWriter(network, addr string, config *NetWriterConfig) (*NetWriter,
+    error) {
+
+    switch network {
+    case "tcp", "tcp4", "tcp6", "tls", "unix":
+    default:
+        return nil, fmt.Errorf("Unsupported network %q for NetWriter",
+            network)
+    }
+
+    w := new(NetWriter)
+    w.network = network
+    w.addr = addr
+    if config != nil {
+        w.config = *config
+    }
+    w.close_chan = make(chan bool)
+
+    if w.config.MinBackoff <= 0 {
+        w.config.MinBackoff = 100 * time.Millisecond
+    }
+    if w.config.MaxBackoff <= 0 {
+        w.config.MaxBackoff = 30 * time.Second
+    }
+    if w.config.MaxBuffered <= 0 {
+        w.config.MaxBuffered = 1000
+    }
+    if w.config.DialTimeout <= 0 {
+        w.config.DialTimeout = 10 * time.Second
+    }
+    if w.config.WriteTimeout <= 0 {
+        w.config.WriteTimeout = 10 * time.Second
+    }
+
+    conn, err := w.dial()
+    if err != nil {
+        w.lock.Lock()
+        w.start_reconnect()
+        w.lock.Unlock()
+        w.notify(false, err)
+    } else {
+        w.conn = conn
+        w.notify(true, nil)
+    }
+
+    return w, nil
+}
+
+// Writes b to the connection. If the writer is disconnected, or the write
+// fails before any of b is sent, b is buffered to be sent after reconnecting,
+// and no error is returned. An error is only returned if the writer has been closed.
+func (w *NetWriter) Write(b []byte) (int, error) {
+    w.lock.Lock()
+
+    if w.closed {
+        w.lock.Unlock()
+        return 0, fmt.Errorf("Write to closed NetWriter")
+    }
+
+    if w.conn == nil {
+        w.buffer_write(b)
+        w.lock.Unlock()
+        return len(b), nil
+    }
+
+    w.conn.SetWriteDeadline(time.Now().Add(w.config.WriteTimeout))
+    n, err := w.conn.Write(b)
+    if err == nil {
+        w.lock.Unlock()
+        return len(b), nil
+    }
+
+    w.conn.Close()
+    w.conn = nil
+    if n == 0 {
+        w.buffer_write(b)
+    } else {
+        w.dropped++
+    }
+    w.start_reconnect()
+    w.lock.Unlock()
+
+    w.notify(false, err)
+
+    return len(b), nil
+}
+
+// Reports whether the writer is currently connected.
+func (w *NetWriter) Connected() bool {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    return w.conn != nil
+}
+
+// Returns the number of writes dropped because the buffer was full, or
+// because the connection failed after only part of them was sent.
+func (w *NetWriter) Dropped() uint64 {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    return w.dropped
+}
+
+// Closes the connection and stops any reconnection attempts. Buffered writes
+// that have not been sent are discarded.
+func (w *NetWriter) Close() error {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    if w.closed {
+        return nil
+    }
+    w.closed = true
+    close(w.close_chan)
+
+    if w.conn != nil {
+        err := w.conn.Close()
+        w.conn = nil
+        return err
+    }
+
+    return nil
+}
+
+// Must be called with the lock held.
+func (w *NetWriter) buffer_write(b []byte) {
+    if len(w.buffer) >= w.config.MaxBuffered {
+        w.buffer = w.buffer[1:]
+        w.dropped++
+    }
+    w.buffer = append(w.buffer, append([]byte(nil), b...))
+}
+
+// Must be called with the lock held.
+func (w *NetWriter) start_reconnect() {
+    if w.reconnecting || w.closed {
+        return
+    }
+    w.reconnecting = true
+
+    go w.reconnect()
+}
+
+func (w *NetWriter) reconnect() {
+    delay := w.config.MinBackoff
+    for {
+        jittered := delay - time.Duration(rand.Int63n(int64(delay / 2) + 1))
+        select {
+        case <-w.close_chan:
+            return
+        case <-time.After(jittered):
+        }
+
+        conn, err := w.dial()
+        if err == nil {
+            err = w.resume(conn)
+            if err == nil {
+                w.notify(true, nil)
+                return
+            }
+        }
+
+        delay *= 2
+        if delay > w.config.MaxBackoff {
+            delay = w.config.MaxBackoff
+        }
+    }
+}
+
+// Sends the buffered writes over a new connection and makes it current.
+func (w *NetWriter) resume(conn net.Conn) error {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    if w.closed {
+        conn.Close()
+        return fmt.Errorf("NetWriter closed")
+    }
+
+    for len(w.buffer) > 0 {
+        conn.SetWriteDeadline(time.Now().Add(w.config.WriteTimeout))
+        if n, err := conn.Write(w.buffer[0]); err != nil {
+            if n > 0 {
+                w.buffer[0] = nil
+                w.buffer = w.buffer[1:]
+                w.dropped++
+            }
+            conn.Close()
+            return err
+        }
+        w.buffer[0] = nil
+        w.buffer = w.buffer[1:]
+    }
+    w.buffer = nil
+
+    w.conn = conn
+    w.reconnecting = false
+
+    return nil
+}
+
+func (w *NetWriter) dial() (net.Conn, error) {
+    dialer := &net.Dialer{Timeout: w.config.DialTimeout}
+    if w.network == "tls" {
+        config := w.config.TLSConfig
+        if config == nil {
+            config = new(tls.Config)
+        }
+        return tls.DialWithDialer(dialer, "tcp", w.addr, config)
+    }
+
+    return dialer.Dial(w.network, w.addr)
+}
+
+func (w *NetWriter) notify(connected bool, err error) {
+    if w.config.OnStateChange != nil {
+        w.config.OnStateChange(connected, err)
+    }
+}
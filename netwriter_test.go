@@ -0,0 +1,337 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bufio"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    log "github.com/cuberat/go-log"
+    "io/ioutil"
+    "math/big"
+    "net"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// A line-oriented server that can be killed and restarted on the same address.
+type LineServer struct {
+    Network string
+    Addr string
+    Lines chan string
+    listener net.Listener
+    conns chan net.Conn
+}
+
+func NewLineServer(t *testing.T, network, addr string) *LineServer {
+    ls := &LineServer{Network: network, Addr: addr,
+        Lines: make(chan string, 100)}
+    ls.Start(t)
+
+    return ls
+}
+
+func (ls *LineServer) Start(t *testing.T) {
+    listener, err := net.Listen(ls.Network, ls.Addr)
+    if err != nil {
+        t.Fatalf("couldn't listen on %s: %s", ls.Addr, err)
+    }
+    ls.listener = listener
+    ls.Addr = listener.Addr().String()
+    ls.conns = make(chan net.Conn, 10)
+
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                close(ls.conns)
+                return
+            }
+            ls.conns <- conn
+            go func() {
+                scanner := bufio.NewScanner(conn)
+                for scanner.Scan() {
+                    ls.Lines <- scanner.Text()
+                }
+            }()
+        }
+    }()
+}
+
+func (ls *LineServer) Kill() {
+    ls.listener.Close()
+    for conn := range ls.conns {
+        conn.Close()
+    }
+}
+
+func (ls *LineServer) WaitFor(t *testing.T, substr string) {
+    for {
+        select {
+        case line := <-ls.Lines:
+            if strings.Contains(line, substr) {
+                return
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("timed out waiting for line containing %q", substr)
+        }
+    }
+}
+
+func TestNetWriterReconnect(t *testing.T) {
+    for _, network := range []string{"tcp", "unix"} {
+        t.Run(network, func(t *testing.T) {
+            addr := "127.0.0.1:0"
+            if network == "unix" {
+                dir, err := ioutil.TempDir("", "go-log-net")
+                if err != nil {
+                    t.Fatalf("couldn't create temp dir: %s", err)
+                }
+                defer os.RemoveAll(dir)
+                addr = filepath.Join(dir, "socket")
+            }
+            test_net_writer_reconnect(t, network, addr)
+        })
+    }
+}
+
+func test_net_writer_reconnect(t *testing.T, network, addr string) {
+    ls := NewLineServer(t, network, addr)
+
+    states := make(chan bool, 10)
+    w, err := log.NewNetWriter(network, ls.Addr, &log.NetWriterConfig{
+        MinBackoff: 10 * time.Millisecond,
+        MaxBackoff: 50 * time.Millisecond,
+        OnStateChange: func(connected bool, err error) {
+            states <- connected
+        },
+    })
+    if err != nil {
+        t.Fatalf("couldn't create NetWriter: %s", err)
+    }
+    defer w.Close()
+
+    if !<-states {
+        t.Fatalf("expected initial connection")
+    }
+
+    logger := log.New(w, log.LOG_DEBUG, "")
+    logger.Info("before restart")
+    ls.WaitFor(t, "before restart")
+
+    ls.Kill()
+    if network == "unix" {
+        os.Remove(ls.Addr)
+    }
+
+    // Writes to a dead connection may appear to succeed until the peer's
+    // reset is seen, so keep writing until the disconnection is noticed.
+    deadline := time.Now().Add(5 * time.Second)
+    for w.Connected() {
+        if time.Now().After(deadline) {
+            t.Fatalf("writer didn't notice disconnection")
+        }
+        logger.Info("probe")
+        time.Sleep(10 * time.Millisecond)
+    }
+    if <-states {
+        t.Fatalf("expected disconnection state change")
+    }
+
+    logger.Info("while disconnected")
+
+    ls.Start(t)
+    if !<-states {
+        t.Fatalf("expected reconnection state change")
+    }
+    ls.WaitFor(t, "while disconnected")
+
+    logger.Info("after restart")
+    ls.WaitFor(t, "after restart")
+    ls.Kill()
+}
+
+func TestNetWriterBufferLimit(t *testing.T) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("couldn't listen: %s", err)
+    }
+    addr := listener.Addr().String()
+    listener.Close()
+
+    w, err := log.NewNetWriter("tcp", addr, &log.NetWriterConfig{
+        MinBackoff: time.Hour,
+        MaxBuffered: 2,
+    })
+    if err != nil {
+        t.Fatalf("couldn't create NetWriter: %s", err)
+    }
+    defer w.Close()
+
+    for i := 0; i < 5; i++ {
+        if _, err := w.Write([]byte("line\n")); err != nil {
+            t.Errorf("buffered write should not fail: %s", err)
+        }
+    }
+    if w.Dropped() != 3 {
+        t.Errorf("expected 3 dropped writes, got %d", w.Dropped())
+    }
+}
+
+func TestNetWriterPartialWrite(t *testing.T) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("couldn't listen: %s", err)
+    }
+    defer listener.Close()
+
+    conns := make(chan net.Conn, 2)
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            conns <- conn
+        }
+    }()
+
+    w, err := log.NewNetWriter("tcp", listener.Addr().String(),
+        &log.NetWriterConfig{
+            MinBackoff: 10 * time.Millisecond,
+            WriteTimeout: 100 * time.Millisecond,
+        })
+    if err != nil {
+        t.Fatalf("couldn't create NetWriter: %s", err)
+    }
+    defer w.Close()
+
+    // Nothing reads from the first connection, so a write larger than the
+    // socket buffers times out after sending part of it.
+    first := <-conns
+    defer first.Close()
+    w.Write([]byte(strings.Repeat("x", 32 << 20) + "\n"))
+    if w.Dropped() != 1 {
+        t.Fatalf("expected the partial write to be dropped, got %d dropped",
+            w.Dropped())
+    }
+    w.Write([]byte("after\n"))
+
+    var second net.Conn
+    select {
+    case second = <-conns:
+    case <-time.After(5 * time.Second):
+        t.Fatalf("timed out waiting for reconnection")
+    }
+    defer second.Close()
+    second.SetReadDeadline(time.Now().Add(5 * time.Second))
+    line, err := bufio.NewReader(second).ReadString('\n')
+    if err != nil || line != "after\n" {
+        t.Errorf("expected only the next line after reconnecting, got %.20q " +
+            "(%v)", line, err)
+    }
+}
+
+func TestNetWriterTLS(t *testing.T) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatalf("couldn't generate key: %s", err)
+    }
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject: pkix.Name{CommonName: "localhost"},
+        IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+        NotBefore: time.Now().Add(-time.Hour),
+        NotAfter: time.Now().Add(time.Hour),
+        ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,
+            x509.ExtKeyUsageClientAuth},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template,
+        &key.PublicKey, key)
+    if err != nil {
+        t.Fatalf("couldn't create certificate: %s", err)
+    }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatalf("couldn't parse certificate: %s", err)
+    }
+    pool := x509.NewCertPool()
+    pool.AddCert(cert)
+    tls_cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+
+    // The server requires the client to present the same certificate.
+    listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+        Certificates: []tls.Certificate{tls_cert},
+        ClientAuth: tls.RequireAndVerifyClientCert,
+        ClientCAs: pool,
+    })
+    if err != nil {
+        t.Fatalf("couldn't listen: %s", err)
+    }
+    defer listener.Close()
+
+    lines := make(chan string, 1)
+    go func() {
+        conn, err := listener.Accept()
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        scanner := bufio.NewScanner(conn)
+        if scanner.Scan() {
+            lines <- scanner.Text()
+        }
+    }()
+
+    w, err := log.NewNetWriter("tls", listener.Addr().String(),
+        &log.NetWriterConfig{TLSConfig: &tls.Config{
+            Certificates: []tls.Certificate{tls_cert},
+            RootCAs: pool,
+        }})
+    if err != nil {
+        t.Fatalf("couldn't create NetWriter: %s", err)
+    }
+    defer w.Close()
+
+    log.New(w, log.LOG_DEBUG, "").Info("over tls")
+
+    select {
+    case line := <-lines:
+        if !strings.Contains(line, "over tls") {
+            t.Errorf("unexpected line over TLS: %q", line)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatalf("timed out waiting for line over TLS")
+    }
+}
@@ -0,0 +1,155 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "os"
+    "regexp"
+    "testing"
+)
+
+type SevFuncTester struct {
+    Name string
+    Sev log.Severity
+    Method func(*log.Logger, string) error
+    Methodf func(*log.Logger, string, ...interface{}) error
+    Pkg func(string) error
+    Pkgf func(string, ...interface{}) error
+}
+
+var sev_func_testers = []*SevFuncTester{
+    &SevFuncTester{"emerg", log.LOG_EMERG, (*log.Logger).Emerg,
+        (*log.Logger).Emergf, log.Emerg, log.Emergf},
+    &SevFuncTester{"alert", log.LOG_ALERT, (*log.Logger).Alert,
+        (*log.Logger).Alertf, log.Alert, log.Alertf},
+    &SevFuncTester{"crit", log.LOG_CRIT, (*log.Logger).Crit,
+        (*log.Logger).Critf, log.Crit, log.Critf},
+    &SevFuncTester{"err", log.LOG_ERR, (*log.Logger).Err,
+        (*log.Logger).Errf, log.Err, log.Errf},
+    &SevFuncTester{"warning", log.LOG_WARNING, (*log.Logger).Warning,
+        (*log.Logger).Warningf, log.Warning, log.Warningf},
+    &SevFuncTester{"notice", log.LOG_NOTICE, (*log.Logger).Notice,
+        (*log.Logger).Noticef, log.Notice, log.Noticef},
+    &SevFuncTester{"info", log.LOG_INFO, (*log.Logger).Info,
+        (*log.Logger).Infof, log.Info, log.Infof},
+    &SevFuncTester{"debug", log.LOG_DEBUG, (*log.Logger).Debug,
+        (*log.Logger).Debugf, log.Debug, log.Debugf},
+}
+
+// Logs a message with each of the four functions for tester's severity,
+// using logger for the methods and the default logger for the package-level
+// functions.
+func log_with_all(logger *log.Logger, tester *SevFuncTester) {
+    tester.Method(logger, "method")
+    tester.Methodf(logger, "%s", "methodf")
+    tester.Pkg("pkg")
+    tester.Pkgf("%s", "pkgf")
+}
+
+// Checks that the severity methods and the package-level severity functions
+// are dispatched the same way, for each severity, on both plain and syslog-like
+// writers.
+func TestSeverityPipeline(t *testing.T) {
+    defer log.SetOutput(os.Stderr)
+    defer log.SetSeverityThreshold(log.LOG_DEBUG)
+    log.SetSeverityThreshold(log.LOG_DEBUG)
+
+    for _, tester := range sev_func_testers {
+        t.Run("plain/" + tester.Name, func(t *testing.T) {
+            buffer := new(bytes.Buffer)
+            logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+            log.SetOutput(buffer)
+
+            log_with_all(logger, tester)
+
+            line_re := regexp.MustCompile(`^\S+ \S+ \[\d+\] ` +
+                `pipeline_test\.go:\d+: (method|methodf|pkg|pkgf)\n$`)
+            method_re := regexp.MustCompile(`^\S+ p: pipeline_test\.go:\d+: ` +
+                `(method|methodf)\n$`)
+            lines := bytes.SplitAfter(buffer.Bytes(), []byte("\n"))
+            if len(lines) != 5 || len(lines[4]) != 0 {
+                t.Fatalf("expected 4 lines, got %q", buffer.String())
+            }
+            for i, line := range lines[:4] {
+                re := line_re
+                if i < 2 {
+                    re = method_re
+                }
+                if !re.Match(line) {
+                    t.Errorf("line %d doesn't match %s: %q", i, re, line)
+                }
+            }
+        })
+
+        t.Run("syslog/" + tester.Name, func(t *testing.T) {
+            recorder := new(MethodRecorder)
+            logger := log.New(recorder, log.LOG_DEBUG, "p: ")
+            log.SetOutput(recorder)
+
+            log_with_all(logger, tester)
+
+            line_re := regexp.MustCompile(`^` + tester.Name +
+                `: pipeline_test\.go:\d+: (method|methodf|pkg|pkgf)$`)
+            if len(recorder.Lines) != 4 {
+                t.Fatalf("expected 4 syslog calls, got %q", recorder.Lines)
+            }
+            for _, line := range recorder.Lines {
+                if !line_re.MatchString(line) {
+                    t.Errorf("line doesn't match %s: %q", line_re, line)
+                }
+            }
+        })
+    }
+}
+
+// Checks that messages without a severity go to the Write method of
+// syslog-like writers, without a timestamp or prefix.
+func TestPrintPipelineSyslog(t *testing.T) {
+    defer log.SetOutput(os.Stderr)
+
+    recorder := new(MethodRecorder)
+    logger := log.New(recorder, log.LOG_DEBUG, "p: ")
+    log.SetOutput(recorder)
+
+    logger.Print("one")
+    logger.Printf("%s", "two")
+    log.Println("three")
+    logger.Write([]byte("four\n"))
+
+    line_re := regexp.MustCompile(
+        `^write: pipeline_test\.go:\d+: (one|two|three|four)$`)
+    if len(recorder.Lines) != 4 {
+        t.Fatalf("expected 4 writes, got %q", recorder.Lines)
+    }
+    for _, line := range recorder.Lines {
+        if !line_re.MatchString(line) {
+            t.Errorf("line doesn't match %s: %q", line_re, line)
+        }
+    }
+}
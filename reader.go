@@ -0,0 +1,742 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// A ParsedRecord is a log record read back from the output of a Logger.
+type ParsedRecord struct {
+    Record
+
+    // The timestamp as it appeared in the line. Time is only set if this
+    // could be parsed.
+    Timestamp string
+
+    // The program name and process ID, if the prefix has the default
+    // "program [pid] " form.
+    Program string
+    PID int
+
+    // The format the record was written in.
+    Format Format
+
+    // The original text of the record, including any continuation lines,
+    // without the final newline.
+    Raw string
+
+    // Set if the line could not be parsed in any of the package's formats.
+    // Only Raw and Message are set in this case.
+    Malformed bool
+}
+
+// A Reader reads log records from the output of a Logger using any of the
+// package's formats, which may be mixed. Lines in FormatText have the layout
+//
+//   [timestamp " "] [label " "] prefix [name ": "] [file ":" line ": "] message
+//
+// or, with LabelSyslog, "<" severity ">" followed by the same without the
+// label. The label is in any of the SeverityLabel styles, the timestamp is in
+// any of the layouts of the package's timestamp generators (or the layout
+// given to SetTimestampLayout()), and the prefix defaults to
+// "program [pid] ". Without Ltimestamp, the default prefix may also come
+// before the timestamp, as in the standard layout. The source is left out
+// when the Logger's flags include neither Lshortfile nor Llongfile. Such a
+// line must start with a timestamp, a label, or the default prefix, and the
+// rest of the line, including a custom prefix or the logger name, is taken as
+// the message. A text line that does not match this layout is a continuation
+// of the previous message, as produced when a message contains newlines, and
+// is appended to that message. Continuation lines starting with
+// MultilineMarker, as written with MultilineIndent, are recognized as such
+// even if they look like the start of a record, and the marker is removed.
+// Lines in FormatJSON and FormatLogfmt are self-contained, one record per
+// line.
+//
+// The key=value pairs that FormatText writes after the message for fields are
+// returned in Fields, with their values as strings. Since they can't be told
+// apart, pairs that end the message itself, as in "set x=1", are taken as
+// fields too.
+type Reader struct {
+    scanner *bufio.Scanner
+    layouts []string
+    unescape bool
+    pending *ParsedRecord
+    err error
+
+    // With a flush timeout, lines are scanned in the background and sent on
+    // lines, which is closed at the end of the input, after setting scan_err.
+    flush_timeout time.Duration
+    lines chan string
+    scan_err error
+}
+
+var (
+    reader_source_re = regexp.MustCompile(`(?:^|\s)(\S+\.go):(\d+): `)
+    reader_prog_pid_re = regexp.MustCompile(`^(\S+) \[(\d+)\]`)
+    reader_unix_re = regexp.MustCompile(`^\d{10}(\d{3})?$`)
+    reader_syslog_label_re = regexp.MustCompile(`^<([0-7])>`)
+    reader_isoweek_re = regexp.MustCompile(
+        `^(\d{4})-W(\d{2})-([1-7])T(\d{2}:\d{2}:\d{2}(?:Z|[+-]\d{2}:\d{2}))$`)
+
+    // Layouts tried when looking for a timestamp, in addition to RFC 3339.
+    reader_layouts = []string{
+        LayoutLocal,
+        time.Stamp,
+        "2006/01/02 15:04:05.000000",
+        "2006/01/02 15:04:05",
+    }
+)
+
+// Creates a Reader reading log lines from r.
+func NewReader(r io.Reader) *Reader {
+    lr := new(Reader)
+    lr.scanner = bufio.NewScanner(r)
+    lr.scanner.Buffer(make([]byte, 0, 64 * 1024), 16 * 1024 * 1024)
+    lr.layouts = reader_layouts
+
+    return lr
+}
+
+// Adds a time.Format() layout to try when looking for timestamps in text
+// lines, for logs written with TimestampLayout(). It is tried before the
+// built-in layouts.
+func (lr *Reader) SetTimestampLayout(layout string) {
+    lr.layouts = append([]string{layout}, reader_layouts...)
+}
+
+// Sets the multi-line policy the log was written with. This is only needed for
+// MultilineEscape, so that escaped newlines in text messages are converted back
+// to newlines.
+func (lr *Reader) SetMultilinePolicy(policy MultilinePolicy) {
+    lr.unescape = policy == MultilineEscape
+}
+
+// Sets how long Next() waits for a continuation line before returning a text
+// record. Normally, a text record is only returned once the following line has
+// been read, or at the end of the input, since the record may continue on the
+// next line. This holds back the last record indefinitely when reading input
+// that is still being written, e.g., from a FollowReader in golog, so the
+// timeout allows the record to be returned once the input has been idle for
+// that long. Lines are then read in a background goroutine, which runs until
+// the end of the input. A timeout of zero or less, the default, waits for the
+// following line. It must be set before the first call to Next().
+func (lr *Reader) SetFlushTimeout(timeout time.Duration) {
+    lr.flush_timeout = timeout
+}
+
+// Results of next_line().
+const (
+    line_ok = iota
+    line_eof
+    line_idle
+)
+
+// Returns the next line of input. If wait is set and there is a flush timeout,
+// it gives up with line_idle once the timeout has passed without a line.
+func (lr *Reader) next_line(wait bool) (string, int) {
+    if lr.flush_timeout <= 0 {
+        if lr.scanner.Scan() {
+            return lr.scanner.Text(), line_ok
+        }
+        return "", line_eof
+    }
+
+    if lr.lines == nil {
+        lr.lines = make(chan string)
+        go lr.scan_lines()
+    }
+
+    var timeout <-chan time.Time
+    if wait {
+        timer := time.NewTimer(lr.flush_timeout)
+        defer timer.Stop()
+        timeout = timer.C
+    }
+
+    select {
+    case line, ok := <-lr.lines:
+        if !ok {
+            return "", line_eof
+        }
+        return line, line_ok
+    case <-timeout:
+        return "", line_idle
+    }
+}
+
+func (lr *Reader) scan_lines() {
+    for lr.scanner.Scan() {
+        lr.lines <- lr.scanner.Text()
+    }
+    lr.scan_err = lr.scanner.Err()
+    close(lr.lines)
+}
+
+// Returns the next record. At the end of the input, it returns nil and
+// io.EOF.
+func (lr *Reader) Next() (*ParsedRecord, error) {
+    rec := lr.pending
+    lr.pending = nil
+
+    for {
+        line, status := lr.next_line(rec != nil)
+        if status == line_idle {
+            return lr.finish(rec), nil
+        }
+        if status == line_eof {
+            break
+        }
+        line = strings.TrimSuffix(line, "\r")
+
+        if rec != nil && rec.Format == FormatText && !rec.Malformed &&
+            strings.HasPrefix(line, MultilineMarker) {
+            rec.Message += "\n" + line[len(MultilineMarker):]
+            rec.Raw += "\n" + line
+            continue
+        }
+
+        next := parse_line(line, lr.layouts)
+
+        if rec == nil {
+            rec = next
+            if rec.Format != FormatText || rec.Malformed {
+                return rec, nil
+            }
+            continue
+        }
+
+        if next.Malformed && rec.Format == FormatText && !rec.Malformed {
+            rec.Message += "\n" + line
+            rec.Raw += "\n" + line
+            continue
+        }
+
+        lr.pending = next
+        return lr.finish(rec), nil
+    }
+
+    err := lr.scan_err
+    if lr.lines == nil {
+        err = lr.scanner.Err()
+    }
+    if err != nil {
+        return nil, err
+    }
+    if rec != nil {
+        return lr.finish(rec), nil
+    }
+
+    return nil, io.EOF
+}
+
+// Completes a text record once all of its lines have been read, moving the
+// fields at the end of the message into Fields and reversing the escaping
+// done by MultilineEscape.
+func (lr *Reader) finish(rec *ParsedRecord) *ParsedRecord {
+    if rec == nil || rec.Format != FormatText || rec.Malformed {
+        return rec
+    }
+
+    rec.Message, rec.Fields = split_text_fields(rec.Message)
+    if lr.unescape {
+        rec.Message = unescape_message(rec.Message)
+    }
+
+    return rec
+}
+
+// Splits the key=value pairs that FormatText appends for fields off the end
+// of msg, returning the rest of the message and the fields in order.
+func split_text_fields(msg string) (string, []Field) {
+    var fields []Field
+    for {
+        var val string
+        var ok bool
+        rest := msg
+        if strings.HasSuffix(rest, `"`) {
+            rest, val, ok = cut_quoted_value(rest)
+        } else {
+            sp := strings.LastIndexByte(rest, ' ')
+            eq := strings.LastIndexByte(rest, '=')
+            if eq > sp && eq < len(rest) - 1 &&
+                strings.IndexByte(rest[eq:], '"') < 0 {
+                rest, val, ok = rest[:eq + 1], rest[eq + 1:], true
+            }
+        }
+        if !ok || !strings.HasSuffix(rest, "=") {
+            break
+        }
+        rest = rest[:len(rest) - 1]
+
+        sp := strings.LastIndexByte(rest, ' ')
+        key := rest[sp + 1:]
+        if sp < 0 || key == "" ||
+            strings.IndexFunc(key, logfmt_needs_quote) >= 0 {
+            break
+        }
+        fields = append(fields, Field{Key: key, Value: val})
+        msg = rest[:sp]
+    }
+
+    // The fields were found from the end.
+    for i, j := 0, len(fields) - 1; i < j; i, j = i + 1, j - 1 {
+        fields[i], fields[j] = fields[j], fields[i]
+    }
+
+    return msg, fields
+}
+
+// Removes the double-quoted value preceded by "=" at the end of s, returning
+// the rest of s, including the "=", and the unquoted value.
+func cut_quoted_value(s string) (string, string, bool) {
+    for end := len(s); ; {
+        start := strings.LastIndex(s[:end], `="`)
+        if start < 0 {
+            return s, "", false
+        }
+        quoted := s[start + 1:]
+        if quoted_len(quoted) == len(quoted) {
+            val, err := strconv.Unquote(quoted)
+            if err != nil {
+                return s, "", false
+            }
+            return s[:start + 1], val, true
+        }
+        end = start
+    }
+}
+
+// Reverses the escaping done by MultilineEscape.
+func unescape_message(msg string) string {
+    if strings.IndexByte(msg, '\\') < 0 {
+        return msg
+    }
+
+    b := new(strings.Builder)
+    for i := 0; i < len(msg); i++ {
+        if msg[i] != '\\' || i + 1 == len(msg) {
+            b.WriteByte(msg[i])
+            continue
+        }
+        i++
+        switch msg[i] {
+        case 'n':
+            b.WriteByte('\n')
+        case 'r':
+            b.WriteByte('\r')
+        default:
+            b.WriteByte(msg[i])
+        }
+    }
+
+    return b.String()
+}
+
+// Severity labels recognized after the timestamp, mapped to the most severe
+// severity with that label.
+var reader_labels = make(map[string]Severity)
+
+func init() {
+    for _, style := range []SeverityLabel{LabelUpper, LabelLower, LabelGlog} {
+        labels := sev_labels[style]
+        for i := len(labels) - 1; i >= 0; i-- {
+            reader_labels[labels[i]] = Severity(i)
+        }
+    }
+}
+
+// Parses a single line of Logger output in any of the package's formats.
+// Continuation lines of multi-line messages can't be recognized on their own,
+// and are returned as malformed records; use a Reader to handle them.
+func ParseLine(line string) *ParsedRecord {
+    rec := parse_line(strings.TrimSuffix(line, "\n"), reader_layouts)
+    if rec.Format == FormatText && !rec.Malformed {
+        rec.Message, rec.Fields = split_text_fields(rec.Message)
+    }
+
+    return rec
+}
+
+func parse_line(line string, layouts []string) *ParsedRecord {
+    var rec *ParsedRecord
+    switch {
+    case strings.HasPrefix(line, "{"):
+        rec = parse_json_line(line)
+    case strings.HasPrefix(line, "time=") ||
+        strings.HasPrefix(line, "severity=") ||
+        strings.HasPrefix(line, "source="):
+        rec = parse_logfmt_line(line)
+    default:
+        rec = parse_text_line(line, layouts)
+    }
+
+    if rec == nil {
+        rec = &ParsedRecord{Raw: line, Malformed: true}
+        rec.Message = line
+        rec.Severity = sev_none
+    }
+
+    return rec
+}
+
+func new_parsed_record(line string, format Format) *ParsedRecord {
+    rec := &ParsedRecord{Raw: line, Format: format}
+    rec.Severity = sev_none
+
+    return rec
+}
+
+func parse_text_line(line string, layouts []string) *ParsedRecord {
+    rec := new_parsed_record(line, FormatText)
+
+    rest := line
+    if m := reader_syslog_label_re.FindStringSubmatch(rest); m != nil {
+        rec.Severity = Severity(m[1][0] - '0')
+        rest = rest[len(m[0]):]
+    }
+
+    // With the standard layout (no Ltimestamp), the prefix comes before the
+    // timestamp.
+    rest = parse_prog_pid(rec, rest)
+    if ts, t, after, ok := parse_timestamp_prefix(rest, layouts); ok {
+        rec.Timestamp = ts
+        rec.Time = t
+        rest = after
+    }
+    if !rec.HasSeverity() {
+        if idx := strings.IndexByte(rest, ' '); idx > 0 {
+            if sev, ok := reader_labels[rest[:idx]]; ok &&
+                (rec.Timestamp != "" || rec.Program != "" ||
+                reader_source_re.MatchString(rest[idx:])) {
+                rec.Severity = sev
+                rest = rest[idx + 1:]
+            }
+        }
+    }
+    if rec.Program == "" {
+        rest = parse_prog_pid(rec, rest)
+    }
+
+    loc := reader_source_re.FindStringSubmatchIndex(rest)
+    if loc == nil {
+        // Without Lshortfile or Llongfile, only the timestamp, the label,
+        // or the default prefix mark the start of a record, and the logger
+        // name can't be told apart from the message.
+        if rec.Timestamp == "" && rec.Program == "" && !rec.HasSeverity() {
+            return nil
+        }
+        rec.Message = rest
+        return rec
+    }
+
+    // Everything up to the source is the prefix, if it is not the default
+    // one, or the logger name.
+    head := rest[:loc[2]]
+    rec.File = rest[loc[2]:loc[3]]
+    rec.Line, _ = strconv.Atoi(rest[loc[4]:loc[5]])
+    rec.Message = rest[loc[1]:]
+
+    if rec.Program == "" {
+        rec.Prefix = head
+    } else if strings.HasSuffix(head, ": ") {
+        rec.Name = strings.TrimSuffix(head, ": ")
+    }
+
+    return rec
+}
+
+// Sets the program, process ID, and prefix of rec if rest starts with the
+// default "program [pid] " prefix, returning the rest of the line after it.
+func parse_prog_pid(rec *ParsedRecord, rest string) string {
+    m := reader_prog_pid_re.FindStringSubmatch(rest)
+    if m == nil {
+        return rest
+    }
+
+    rec.Program = m[1]
+    rec.PID, _ = strconv.Atoi(m[2])
+    rec.Prefix = m[0]
+    if strings.HasPrefix(rest[len(m[0]):], " ") {
+        rec.Prefix += " "
+    }
+
+    return rest[len(rec.Prefix):]
+}
+
+// Looks for a timestamp at the start of a line, returning the timestamp text,
+// its parsed time (if it could be parsed), and the rest of the line after the
+// following space.
+func parse_timestamp_prefix(line string, layouts []string) (string,
+    time.Time, string, bool) {
+
+    // Timestamps consisting of a single word.
+    if idx := strings.IndexByte(line, ' '); idx > 0 {
+        if t, ok := parse_timestamp(line[:idx]); ok {
+            return line[:idx], t, line[idx + 1:], true
+        }
+    }
+
+    // Layouts that may contain spaces, matched by the number of spaces. A
+    // space-padded day ("_2") may add a space.
+    for _, layout := range layouts {
+        spaces := strings.Count(layout, " ") + 1
+        for extra := 0; extra <= strings.Count(layout, "_2"); extra++ {
+            idx := nth_space(line, spaces + extra)
+            if idx < 0 {
+                continue
+            }
+            if t, err := time.Parse(layout, line[:idx]); err == nil {
+                return line[:idx], t, line[idx + 1:], true
+            }
+        }
+    }
+
+    return "", time.Time{}, line, false
+}
+
+// Parses a timestamp in one of the single-word formats produced by the
+// package's timestamp generators.
+func parse_timestamp(ts string) (time.Time, bool) {
+    if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+        return t, true
+    }
+
+    if reader_unix_re.MatchString(ts) {
+        n, _ := strconv.ParseInt(ts, 10, 64)
+        if len(ts) > 10 {
+            return time.Unix(0, n * int64(time.Millisecond)), true
+        }
+        return time.Unix(n, 0), true
+    }
+
+    if m := reader_isoweek_re.FindStringSubmatch(ts); m != nil {
+        year, _ := strconv.Atoi(m[1])
+        week, _ := strconv.Atoi(m[2])
+        weekday, _ := strconv.Atoi(m[3])
+        clock, err := time.Parse("15:04:05Z07:00", m[4])
+        if err != nil {
+            return time.Time{}, false
+        }
+
+        // January 4th is always in week 1.
+        jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, clock.Location())
+        jan4_weekday := int(jan4.Weekday())
+        if jan4_weekday == 0 {
+            jan4_weekday = 7
+        }
+        day := jan4.AddDate(0, 0, (week - 1) * 7 + weekday - jan4_weekday)
+
+        return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(),
+            clock.Minute(), clock.Second(), 0, clock.Location()), true
+    }
+
+    return time.Time{}, false
+}
+
+// Returns the index of the nth space in s, or -1.
+func nth_space(s string, n int) int {
+    idx := -1
+    for i := 0; i < n; i++ {
+        next := strings.IndexByte(s[idx + 1:], ' ')
+        if next < 0 {
+            return -1
+        }
+        idx += next + 1
+    }
+
+    return idx
+}
+
+func parse_json_line(line string) *ParsedRecord {
+    rec := new_parsed_record(line, FormatJSON)
+
+    dec := json.NewDecoder(strings.NewReader(line))
+    dec.UseNumber()
+    if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+        return nil
+    }
+
+    for dec.More() {
+        tok, err := dec.Token()
+        if err != nil {
+            return nil
+        }
+        key, _ := tok.(string)
+
+        var val interface{}
+        if err := dec.Decode(&val); err != nil {
+            return nil
+        }
+
+        str, is_str := val.(string)
+        if !is_str || !set_parsed_field(rec, key, str) {
+            if num, ok := val.(json.Number); ok {
+                val = json_number_value(num)
+            }
+            rec.Fields = append(rec.Fields, Field{Key: key, Value: val})
+        }
+    }
+
+    if tok, err := dec.Token(); err != nil || tok != json.Delim('}') {
+        return nil
+    }
+
+    return rec
+}
+
+func json_number_value(num json.Number) interface{} {
+    if i, err := num.Int64(); err == nil {
+        return i
+    }
+    if f, err := num.Float64(); err == nil {
+        return f
+    }
+
+    return num.String()
+}
+
+func parse_logfmt_line(line string) *ParsedRecord {
+    rec := new_parsed_record(line, FormatLogfmt)
+
+    rest := line
+    for rest != "" {
+        eq := strings.IndexByte(rest, '=')
+        if eq <= 0 || strings.IndexByte(rest[:eq], ' ') >= 0 {
+            return nil
+        }
+        key := rest[:eq]
+        rest = rest[eq + 1:]
+
+        var val string
+        if strings.HasPrefix(rest, `"`) {
+            end := quoted_len(rest)
+            if end < 0 {
+                return nil
+            }
+            var err error
+            if val, err = strconv.Unquote(rest[:end]); err != nil {
+                return nil
+            }
+            rest = rest[end:]
+        } else if sp := strings.IndexByte(rest, ' '); sp >= 0 {
+            val = rest[:sp]
+            rest = rest[sp:]
+        } else {
+            val = rest
+            rest = ""
+        }
+
+        if rest != "" && !strings.HasPrefix(rest, " ") {
+            return nil
+        }
+        rest = strings.TrimLeft(rest, " ")
+
+        if !set_parsed_field(rec, key, val) {
+            rec.Fields = append(rec.Fields, Field{Key: key, Value: val})
+        }
+    }
+
+    return rec
+}
+
+// Returns the length of the double-quoted string at the start of s, including
+// the quotes, or -1 if it is not terminated.
+func quoted_len(s string) int {
+    for i := 1; i < len(s); i++ {
+        switch s[i] {
+        case '\\':
+            i++
+        case '"':
+            return i + 1
+        }
+    }
+
+    return -1
+}
+
+// Sets a standard field of a record from a JSON or logfmt key. Returns false if
+// the key is not a standard one, or its value is invalid.
+func set_parsed_field(rec *ParsedRecord, key, val string) bool {
+    switch key {
+    case "time":
+        rec.Timestamp = val
+        rec.Time, _ = parse_timestamp(val)
+    case "severity":
+        sev, err := SeverityFromString(val)
+        if err != nil {
+            return false
+        }
+        rec.Severity = sev
+    case "prefix":
+        rec.Prefix = val
+        if m := reader_prog_pid_re.FindStringSubmatch(val); m != nil {
+            rec.Program = m[1]
+            rec.PID, _ = strconv.Atoi(m[2])
+        }
+    case "logger":
+        rec.Name = val
+    case "source":
+        colon := strings.LastIndexByte(val, ':')
+        if colon < 0 {
+            return false
+        }
+        line, err := strconv.Atoi(val[colon + 1:])
+        if err != nil {
+            return false
+        }
+        rec.File = val[:colon]
+        rec.Line = line
+    case "msg":
+        rec.Message = val
+    default:
+        return false
+    }
+
+    return true
+}
+
+// Returns a short description of a parsed record, for debugging.
+func (rec *ParsedRecord) String() string {
+    buf := new(bytes.Buffer)
+    fmt.Fprintf(buf, "%s %s", rec.Format, rec.Timestamp)
+    if rec.HasSeverity() {
+        fmt.Fprintf(buf, " %s", rec.Severity.name())
+    }
+    fmt.Fprintf(buf, " %q %s:%d: %q", rec.Prefix, rec.File, rec.Line,
+        rec.Message)
+
+    return buf.String()
+}
@@ -0,0 +1,232 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "io"
+    "strings"
+    "testing"
+    "time"
+)
+
+func read_all_records(t *testing.T, r io.Reader) []*log.ParsedRecord {
+    lr := log.NewReader(r)
+    var recs []*log.ParsedRecord
+    for {
+        rec, err := lr.Next()
+        if err == io.EOF {
+            return recs
+        }
+        if err != nil {
+            t.Fatalf("error reading records: %s", err)
+        }
+        recs = append(recs, rec)
+    }
+}
+
+func TestReaderFormats(t *testing.T) {
+    ts := time.Date(2020, time.September, 9, 13, 4, 5, 0, time.UTC)
+
+    for _, format := range []log.Format{log.FormatText, log.FormatJSON,
+        log.FormatLogfmt} {
+
+        t.Run(format.String(), func(t *testing.T) {
+            buffer := new(bytes.Buffer)
+            logger := log.New(buffer, log.LOG_DEBUG, "myapp [123] ")
+            logger.SetFormat(format)
+            logger.SetTimestampFunc(func(time.Time) string {
+                return log.TimestampRFC3339Milli(ts)
+            })
+
+            logger.Named("db").Err("first line\nsecond line")
+            logger.Print("printed")
+
+            recs := read_all_records(t, buffer)
+            if len(recs) != 2 {
+                t.Fatalf("expected 2 records, got %d: %v", len(recs), recs)
+            }
+
+            rec := recs[0]
+            if rec.Format != format || rec.Malformed {
+                t.Errorf("unexpected format for %v", rec)
+            }
+            if !rec.Time.Equal(ts) {
+                t.Errorf("expected time %s, got %s", ts, rec.Time)
+            }
+            if rec.Program != "myapp" || rec.PID != 123 {
+                t.Errorf("unexpected program/pid: %q %d", rec.Program, rec.PID)
+            }
+            if rec.Name != "db" {
+                t.Errorf("expected name \"db\", got %q", rec.Name)
+            }
+            if rec.File != "reader_test.go" || rec.Line == 0 {
+                t.Errorf("unexpected source %s:%d", rec.File, rec.Line)
+            }
+            if rec.Message != "first line\nsecond line" {
+                t.Errorf("unexpected message %q", rec.Message)
+            }
+            if format != log.FormatText && rec.Severity != log.LOG_ERR {
+                t.Errorf("expected severity LOG_ERR, got %d", rec.Severity)
+            }
+            if recs[1].Message != "printed" || recs[1].HasSeverity() {
+                t.Errorf("unexpected second record %v", recs[1])
+            }
+        })
+    }
+}
+
+func TestReaderMalformed(t *testing.T) {
+    input := "garbage at start\n" +
+        "{\"msg\": \"broken json\"\n" +
+        "2020-09-09T13:04:05Z myapp [1] main.go:10: ok\n" +
+        "Sep  9 13:04:05 prog [2] util.go:3: syslog style\n" +
+        "1599656645 x.go:1: no prefix\n"
+
+    recs := read_all_records(t, strings.NewReader(input))
+    if len(recs) != 5 {
+        t.Fatalf("expected 5 records, got %d: %v", len(recs), recs)
+    }
+
+    if !recs[0].Malformed || recs[0].Raw != "garbage at start" {
+        t.Errorf("expected malformed first record, got %v", recs[0])
+    }
+    if !recs[1].Malformed {
+        t.Errorf("expected malformed JSON record, got %v", recs[1])
+    }
+    if recs[2].Malformed || recs[2].Message != "ok" {
+        t.Errorf("unexpected third record %v", recs[2])
+    }
+    if recs[3].Timestamp != "Sep  9 13:04:05" || recs[3].Program != "prog" {
+        t.Errorf("unexpected syslog-style record %v", recs[3])
+    }
+    if recs[4].Time.Unix() != 1599656645 || recs[4].File != "x.go" {
+        t.Errorf("unexpected unix timestamp record %v", recs[4])
+    }
+}
+
+func TestReaderFlushTimeout(t *testing.T) {
+    pr, pw := io.Pipe()
+    defer pw.Close()
+
+    lr := log.NewReader(pr)
+    lr.SetFlushTimeout(10 * time.Millisecond)
+    go io.WriteString(pw, "2020-01-01T00:00:00Z a.go:1: first\n" +
+        "  | continued\n")
+
+    done := make(chan *log.ParsedRecord)
+    go func() {
+        rec, _ := lr.Next()
+        done <- rec
+    }()
+
+    select {
+    case rec := <-done:
+        if rec == nil || rec.Message != "first\ncontinued" {
+            t.Errorf("unexpected record %v", rec)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatalf("record wasn't returned while the input was idle")
+    }
+}
+
+func TestReaderNoSource(t *testing.T) {
+    for _, flags := range []int{log.LstdFlags, log.Ltimestamp,
+        log.LstdFlags | log.Lmicroseconds} {
+
+        buffer := new(bytes.Buffer)
+        logger := log.New(buffer, log.LOG_DEBUG, "myapp [123] ")
+        logger.SetFlags(flags)
+        logger.SetSeverityLabel(log.LabelUpper)
+
+        logger.Info("first")
+        logger.Warning("second\ncontinued")
+        logger.Err("third")
+
+        recs := read_all_records(t, buffer)
+        if len(recs) != 3 {
+            t.Fatalf("flags %d: expected 3 records, got %d: %v", flags,
+                len(recs), recs)
+        }
+        for i, expected := range []string{"first", "second\ncontinued",
+            "third"} {
+            rec := recs[i]
+            if rec.Malformed || rec.Message != expected ||
+                rec.Program != "myapp" || rec.Timestamp == "" {
+                t.Errorf("flags %d: unexpected record %d: %+v", flags, i, rec)
+            }
+        }
+        if recs[1].Severity != log.LOG_WARNING {
+            t.Errorf("flags %d: expected LOG_WARNING, got %v", flags,
+                recs[1].Severity)
+        }
+    }
+}
+
+func TestReaderTextFields(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "myapp [123] ")
+    for _, policy := range []log.MultilinePolicy{log.MultilineRaw,
+        log.MultilineEscape} {
+
+        buffer.Reset()
+        logger.SetMultilinePolicy(policy)
+        logger.With("user", "bob", "note", "two words", "quote", `say "hi"`,
+            "empty", "").Info("logged in\nfrom x=1")
+
+        lr := log.NewReader(buffer)
+        lr.SetMultilinePolicy(policy)
+        rec, err := lr.Next()
+        if err != nil {
+            t.Fatalf("%v: couldn't read record: %s", policy, err)
+        }
+        if rec.Message != "logged in\nfrom" {
+            t.Errorf("%v: unexpected message %q", policy, rec.Message)
+        }
+
+        // "x=1" can't be told apart from a field.
+        expected := []log.Field{{Key: "x", Value: "1"},
+            {Key: "user", Value: "bob"}, {Key: "note", Value: "two words"},
+            {Key: "quote", Value: `say "hi"`}, {Key: "empty", Value: ""}}
+        if len(rec.Fields) != len(expected) {
+            t.Fatalf("%v: expected fields %v, got %v", policy, expected,
+                rec.Fields)
+        }
+        for i, field := range expected {
+            if rec.Fields[i] != field {
+                t.Errorf("%v: expected field %v, got %v", policy, field,
+                    rec.Fields[i])
+            }
+        }
+    }
+
+    rec := log.ParseLine(`2020-09-09T13:04:05Z a.go:1: no fields=`)
+    if rec.Message != "no fields=" || len(rec.Fields) != 0 {
+        t.Errorf("unexpected record %+v", rec)
+    }
+}
@@ -0,0 +1,145 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "fmt"
+    "path"
+    "strconv"
+    "time"
+)
+
+// If the io.Writer passed to New() or SetOutput() implements the RecordWriter
+// interface, each message is passed to it as a Record rather than being
+// formatted as a line of text. This allows writers for structured logging
+// systems to keep the metadata separate from the message. The Logger
+// serializes calls to WriteRecord, as it does calls to Write.
+type RecordWriter interface {
+    WriteRecord(rec *Record) error
+    Write(b []byte) (int, error)
+}
+
+// A Record is a single log message with its metadata.
+type Record struct {
+    // The time the message was logged, in the logger's time location.
+    Time time.Time
+
+    // The severity of the message. This is negative for messages logged
+    // without a severity, e.g., with Print() or Write(). See HasSeverity().
+    Severity Severity
+
+    // The syslog facility set with SetFacility(). This is LOG_KERN, the zero
+    // value, if none was set. See HasFacility().
+    Facility Facility
+
+    // The logger's prefix and the dot-separated name of the logger, if it was
+    // created with Named().
+    Prefix string
+    Name string
+
+    // The full path of the source file, line number, and fully-qualified
+    // function name of the caller.
+    File string
+    Line int
+    Func string
+
+    // The message, without a trailing newline.
+    Message string
+
+    // Structured fields attached to the logger with With().
+    Fields []Field
+
+    // The cached source information for File and Line, if logged by a Logger.
+    caller *caller_info
+}
+
+// A Field is a key/value pair attached to a log record.
+type Field struct {
+    Key string
+    Value interface{}
+}
+
+// Reports whether the record was logged with a severity.
+func (rec *Record) HasSeverity() bool {
+    return rec.Severity >= LOG_EMERG
+}
+
+// Reports whether the record has a syslog facility.
+func (rec *Record) HasFacility() bool {
+    return rec.Facility > LOG_KERN
+}
+
+// Returns the source of the record as "file:line", with the base name of the
+// source file.
+func (rec *Record) Source() string {
+    if ci := rec.caller; ci != nil && ci.line == rec.Line &&
+        ci.file == rec.File {
+        return ci.source
+    }
+
+    return path.Base(rec.File) + ":" + strconv.Itoa(rec.Line)
+}
+
+// Creates a child logger that attaches the given fields to every record it
+// logs, in addition to any fields attached to this logger. The arguments are
+// alternating keys and values, e.g., With("user", user_id, "attempt", 3).
+// Keys that are not strings are converted with fmt.Sprint(), and a trailing
+// key without a value gets a nil value. The child shares this logger's Writer,
+// lock, settings, and name, and inherits its severity threshold, as with
+// Named().
+func (l *Logger) With(kv ...interface{}) *Logger {
+    child := new(Logger)
+    child.core = l.core
+    child.parent = l
+    child.name = l.name
+
+    child.fields = make([]Field, 0, len(l.fields) + (len(kv) + 1) / 2)
+    child.fields = append(child.fields, l.fields...)
+    for i := 0; i < len(kv); i += 2 {
+        field := Field{}
+        if key, ok := kv[i].(string); ok {
+            field.Key = key
+        } else {
+            field.Key = fmt.Sprint(kv[i])
+        }
+        if i + 1 < len(kv) {
+            field.Value = kv[i + 1]
+        }
+        child.fields = append(child.fields, field)
+    }
+
+    return child
+}
+
+// Returns a copy of the fields attached to the logger with With().
+func (l *Logger) Fields() []Field {
+    if l.fields == nil {
+        return nil
+    }
+
+    return append([]Field(nil), l.fields...)
+}
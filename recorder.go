@@ -0,0 +1,163 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "fmt"
+    "io"
+    "sync"
+)
+
+// The key of the field added to messages written by the flight recorder when
+// it is triggered. See SetFlightRecorder().
+const BackfillKey = "backfill"
+
+// A ring buffer of records that were below the severity threshold.
+type flight_recorder struct {
+    lock sync.Mutex
+    records []*Record
+    next int
+    full bool
+    trigger Severity
+}
+
+// Turns on the flight recorder, which keeps the last size messages that were
+// below the severity threshold in memory. When a message with severity trigger
+// or more severe is logged, the kept messages are written first, oldest first,
+// each with the field backfill=true, and then discarded. This allows running
+// with a high threshold while still seeing the debug context of an error.
+// Messages are formatted when they are logged, so that they capture the
+// values at that time. A size of zero or less turns the flight recorder off.
+//
+// The flight recorder is shared by a logger and all of the loggers created
+// from it with Named() or With().
+func (l *Logger) SetFlightRecorder(size int, trigger Severity) {
+    if size <= 0 {
+        l.core.recorder = nil
+        return
+    }
+
+    l.core.recorder = &flight_recorder{records: make([]*Record, size),
+        trigger: trigger}
+}
+
+// Writes the messages currently kept by the flight recorder to w, oldest
+// first, in the logger's format, without discarding them. Nothing is written
+// if the flight recorder is off.
+func (l *Logger) DumpRecent(w io.Writer) error {
+    fr := l.core.recorder
+    if fr == nil {
+        return nil
+    }
+
+    for _, rec := range fr.snapshot(false) {
+        if _, err := fmt.Fprint(w, l.format_record(rec, 0)); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func (fr *flight_recorder) add(rec *Record) {
+    fr.lock.Lock()
+    defer fr.lock.Unlock()
+
+    fr.records[fr.next] = rec
+    fr.next++
+    if fr.next == len(fr.records) {
+        fr.next = 0
+        fr.full = true
+    }
+}
+
+// Returns the kept records, oldest first, discarding them if clear is true.
+func (fr *flight_recorder) snapshot(clear bool) []*Record {
+    fr.lock.Lock()
+    defer fr.lock.Unlock()
+
+    var recs []*Record
+    if fr.full {
+        recs = append(recs, fr.records[fr.next:]...)
+    }
+    recs = append(recs, fr.records[:fr.next]...)
+
+    if clear {
+        for i := range fr.records {
+            fr.records[i] = nil
+        }
+        fr.next = 0
+        fr.full = false
+    }
+
+    return recs
+}
+
+// Keeps a message that is below the severity threshold in the flight
+// recorder, if it is on.
+func (l *Logger) record_recent(call_depth int, sev Severity, m string) error {
+    if fr := l.core.recorder; fr != nil {
+        fr.add(l.build_record(call_depth + 1, sev, m))
+    }
+
+    return nil
+}
+
+func (l *Logger) record_recentf(call_depth int, sev Severity, format string,
+    v ...interface{}) error {
+
+    if fr := l.core.recorder; fr != nil {
+        fr.add(l.build_record(call_depth + 1, sev, sprintf(format, v...)))
+    }
+
+    return nil
+}
+
+// Writes out and discards the messages kept by the flight recorder, if a
+// message with severity sev triggers it.
+func (l *Logger) flush_recent(sev Severity) error {
+    fr := l.core.recorder
+    if fr == nil || sev > fr.trigger || sev < LOG_EMERG {
+        return nil
+    }
+
+    recs := fr.snapshot(true)
+    if len(recs) == 0 {
+        return nil
+    }
+
+    for _, rec := range recs {
+        fields := make([]Field, 0, len(rec.Fields) + 1)
+        fields = append(fields, rec.Fields...)
+        rec.Fields = append(fields, Field{Key: BackfillKey, Value: true})
+        if err := l.emit_record(rec); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,92 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "strings"
+    "testing"
+)
+
+func TestFlightRecorder(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_WARNING, "p: ")
+    logger.SetTimestampFunc(nil)
+    logger.SetFlightRecorder(2, log.LOG_ERR)
+
+    logger.Debug("one")
+    logger.Infof("%s", "two")
+    logger.Named("db").Debug("three")
+    logger.Warning("four")
+    if strings.Contains(buffer.String(), "backfill") {
+        t.Fatalf("flight recorder flushed on a warning: %q", buffer.String())
+    }
+
+    recent := new(bytes.Buffer)
+    if err := logger.DumpRecent(recent); err != nil {
+        t.Fatalf("couldn't dump recent messages: %s", err)
+    }
+    dumped := recent.String()
+    if strings.Contains(dumped, "one") || !strings.Contains(dumped, "two") ||
+        !strings.Contains(dumped, "db: ") ||
+        strings.Contains(dumped, "backfill") {
+        t.Errorf("unexpected dump %q", dumped)
+    }
+
+    buffer.Reset()
+    logger.Err("five")
+    lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+    if len(lines) != 3 {
+        t.Fatalf("expected 3 lines, got %q", buffer.String())
+    }
+    if !strings.HasSuffix(lines[0], ": two backfill=true") ||
+        !strings.HasSuffix(lines[1], ": three backfill=true") ||
+        !strings.HasSuffix(lines[2], ": five") {
+        t.Errorf("unexpected output %q", lines)
+    }
+
+    // The history is discarded once written.
+    buffer.Reset()
+    logger.Err("six")
+    if strings.Contains(buffer.String(), "backfill") {
+        t.Errorf("history written twice: %q", buffer.String())
+    }
+}
+
+func TestFlightRecorderOff(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_WARNING, "p: ")
+    logger.SetFlightRecorder(2, log.LOG_ERR)
+    logger.SetFlightRecorder(0, log.LOG_ERR)
+
+    logger.Debug("one")
+    logger.Err("two")
+    if strings.Contains(buffer.String(), "one") {
+        t.Errorf("disabled flight recorder wrote history: %q", buffer.String())
+    }
+}
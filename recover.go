@@ -0,0 +1,156 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "fmt"
+    "runtime"
+    "runtime/debug"
+    "strings"
+)
+
+// The RecoverAction type selects what Recover() does after logging a panic.
+type RecoverAction int
+
+// Actions to be passed to RecoverThen().
+const (
+    // Swallow the panic, so that the function deferring Recover() returns
+    // normally to its caller. This is the default.
+    RecoverSwallow RecoverAction = iota
+    // Panic again with the same value.
+    RecoverRepanic
+    // Exit as the Fatal family of methods does.
+    RecoverExit
+)
+
+// A RecoverOption changes the behavior of Recover().
+type RecoverOption func(opts *recover_opts)
+
+type recover_opts struct {
+    sev Severity
+    action RecoverAction
+}
+
+// Sets the severity at which Recover() logs the panic. The default is LOG_CRIT.
+func RecoverSeverity(sev Severity) RecoverOption {
+    return func(opts *recover_opts) {
+        opts.sev = sev
+    }
+}
+
+// Sets what Recover() does after logging the panic.
+func RecoverThen(action RecoverAction) RecoverOption {
+    return func(opts *recover_opts) {
+        opts.action = action
+    }
+}
+
+// Recovers from a panic and logs the panic value and the stack of the
+// panicking goroutine. It must be called directly by defer, e.g.,
+//
+//   defer logger.Recover(log.RecoverThen(log.RecoverRepanic))
+//
+// The source of the message is the function that panicked, rather than the
+// deferred call. By default, the message is logged at LOG_CRIT and the panic
+// is swallowed. Recover() does nothing if the goroutine is not panicking.
+func (l *Logger) Recover(opts ...RecoverOption) {
+    r := recover()
+    if r == nil {
+        return
+    }
+
+    l.handle_panic(r, opts)
+}
+
+// Recovers from a panic and logs it with the default logger. See
+// Logger.Recover() for details.
+func Recover(opts ...RecoverOption) {
+    r := recover()
+    if r == nil {
+        return
+    }
+
+    default_logger.handle_panic(r, opts)
+}
+
+func (l *Logger) handle_panic(r interface{}, opt_funcs []RecoverOption) {
+    opts := &recover_opts{sev: LOG_CRIT, action: RecoverSwallow}
+    for _, opt_func := range opt_funcs {
+        opt_func(opts)
+    }
+
+    // Two frames up is the deferred Recover() call itself, used if the
+    // panicking frame can't be found.
+    rec := l.build_record(2, opts.sev, fmt.Sprintf("panic: %v\n%s", r,
+        strings.TrimSuffix(string(debug.Stack()), "\n")))
+    set_panic_source(rec)
+
+    thresh := l.SeverityThreshold()
+    if mod_thresh, found := l.module_threshold(rec.File); found {
+        thresh = mod_thresh
+    }
+    if opts.sev <= thresh {
+        l.flush_recent(opts.sev)
+        l.core.stats.count_emitted(opts.sev)
+        l.emit_record(rec)
+    } else {
+        l.core.stats.count_suppressed(opts.sev)
+    }
+
+    switch opts.action {
+    case RecoverRepanic:
+        panic(r)
+    case RecoverExit:
+        l.exit()
+    }
+}
+
+// Sets the source of rec to the first frame outside the runtime below
+// runtime.gopanic, i.e., the function that called panic() or caused a runtime
+// error.
+func set_panic_source(rec *Record) {
+    pcs := make([]uintptr, 64)
+    n := runtime.Callers(1, pcs)
+    frames := runtime.CallersFrames(pcs[:n])
+
+    found_panic := false
+    for {
+        frame, more := frames.Next()
+        if frame.Function == "runtime.gopanic" {
+            found_panic = true
+        } else if found_panic &&
+            !strings.HasPrefix(frame.Function, "runtime.") {
+            rec.File = frame.File
+            rec.Line = frame.Line
+            rec.Func = frame.Function
+            return
+        }
+        if !more {
+            return
+        }
+    }
+}
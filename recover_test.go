@@ -0,0 +1,114 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    "fmt"
+    log "github.com/cuberat/go-log"
+    "runtime"
+    "strings"
+    "testing"
+)
+
+// The source of the last panic in panicky().
+var panic_source string
+
+func panicky(logger *log.Logger, opts ...log.RecoverOption) {
+    defer logger.Recover(opts...)
+
+    var m map[string]int
+    _, _, line, _ := runtime.Caller(0)
+    panic_source = fmt.Sprintf("recover_test.go:%d", line + 2)
+    m["boom"] = 1
+}
+
+func TestRecover(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    logger.SetTimestampFunc(nil)
+
+    panicky(logger)
+
+    output := buffer.String()
+    if !strings.HasPrefix(output, "p: " + panic_source +
+        ": panic: assignment to entry in nil map\n") {
+        t.Errorf("unexpected output %q", output)
+    }
+    if !strings.Contains(output, "goroutine ") ||
+        !strings.Contains(output, "log_test.panicky") {
+        t.Errorf("output doesn't include the stack: %q", output)
+    }
+}
+
+func TestRecoverRepanic(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+
+    func() {
+        defer func() {
+            if r := recover(); r == nil {
+                t.Errorf("expected the panic to be repeated")
+            }
+        }()
+        panicky(logger, log.RecoverThen(log.RecoverRepanic))
+    }()
+
+    if !strings.Contains(buffer.String(), "panic: ") {
+        t.Errorf("panic wasn't logged: %q", buffer.String())
+    }
+}
+
+func TestRecoverSeverity(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_WARNING, "p: ")
+
+    panicky(logger, log.RecoverSeverity(log.LOG_INFO))
+    if buffer.Len() != 0 {
+        t.Errorf("panic logged below the threshold: %q", buffer.String())
+    }
+    if logger.Stats().Suppressed["info"] != 1 {
+        t.Errorf("suppressed panic wasn't counted")
+    }
+
+    panicky(logger, log.RecoverSeverity(log.LOG_ERR))
+    if buffer.Len() == 0 {
+        t.Errorf("panic wasn't logged")
+    }
+}
+
+func TestRecoverNoPanic(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+
+    func() {
+        defer logger.Recover()
+    }()
+    if buffer.Len() != 0 {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+}
@@ -0,0 +1,326 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// The Redactable interface can be implemented by types whose values may hold
+// secrets or personal data. When a Redactable value is passed as an argument
+// to a logging function, or as a field value to With(), it is replaced by the
+// string returned by its Redacted method before the message is formatted. This
+// is done whether or not a Redactor has been set.
+type Redactable interface {
+    Redacted() string
+}
+
+// Key names masked by a new Redactor. A key matches if its name contains one
+// of these, ignoring case, so "password" also covers "db_password" and
+// "X-Password".
+var DefaultRedactKeys = []string{"password", "passwd", "secret", "token",
+    "authorization", "api_key", "api-key", "apikey", "cookie"}
+
+// A regular expression matching email addresses, for use with AddPattern().
+const EmailPattern = `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`
+
+// The default mask used by a Redactor.
+const DefaultRedactMask = "[REDACTED]"
+
+var card_re = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+
+// A Redactor removes secrets and personal data from log messages and field
+// values before they are written. It replaces
+//
+//   * the value following a known key name, as in "password=hunter2",
+//     `"token": "abc"`, or "Authorization:[Bearer abc]",
+//   * the values of fields whose key matches a known key name,
+//   * text matching any of the added regular expressions, and
+//   * digit sequences that look like payment card numbers, i.e., that have
+//     13 to 19 digits, optionally separated by spaces or dashes, and pass the
+//     Luhn check
+//
+// with a mask or, if a hash salt has been set, with a salted hash of the
+// original text, so that repeated values can still be correlated.
+//
+// A Redactor must not be modified once it has been passed to SetRedactor().
+type Redactor struct {
+    keys []string
+    key_re *regexp.Regexp
+    patterns []*regexp.Regexp
+    detect_cards bool
+    mask string
+    salt []byte
+}
+
+// Creates a Redactor that masks the values of the DefaultRedactKeys and
+// payment card numbers.
+func NewRedactor() *Redactor {
+    r := &Redactor{detect_cards: true, mask: DefaultRedactMask}
+    r.AddKeys(DefaultRedactKeys...)
+
+    return r
+}
+
+// Adds key names whose values are to be redacted.
+func (r *Redactor) AddKeys(keys ...string) {
+    for _, key := range keys {
+        if key != "" {
+            r.keys = append(r.keys, strings.ToLower(key))
+        }
+    }
+    r.key_re = nil
+    if len(r.keys) == 0 {
+        return
+    }
+
+    quoted := make([]string, len(r.keys))
+    for i, key := range r.keys {
+        quoted[i] = regexp.QuoteMeta(key)
+    }
+
+    // Group 1 is everything up to the value: the key, an optional closing
+    // quote, the separator, and an optional opening bracket, as printed for
+    // http.Header and other maps of slices. Group 2 is the value.
+    r.key_re = regexp.MustCompile(`(?i)([\w.\-]*(?:` +
+        strings.Join(quoted, "|") + `)[\w.\-]*["']?\s*[:=]\s*\[?)` +
+        `("(?:[^"\\]|\\.)*"|'[^']*'|` +
+        `(?:bearer|basic|digest|token)\s+[^\s,;&"'}\])]+|` +
+        `[^\s,;&"'}\])]+)`)
+}
+
+// Adds a regular expression. Any text matching it is redacted.
+func (r *Redactor) AddPattern(expr string) error {
+    re, err := regexp.Compile(expr)
+    if err != nil {
+        return fmt.Errorf("Invalid redaction pattern %q: %s", expr, err)
+    }
+    r.AddRegexp(re)
+
+    return nil
+}
+
+// Adds a compiled regular expression. Any text matching it is redacted.
+func (r *Redactor) AddRegexp(re *regexp.Regexp) {
+    r.patterns = append(r.patterns, re)
+}
+
+// Turns detection of payment card numbers on or off. It is on by default.
+func (r *Redactor) SetDetectCards(detect bool) {
+    r.detect_cards = detect
+}
+
+// Sets the text that replaces redacted values. The default is
+// DefaultRedactMask.
+func (r *Redactor) SetMask(mask string) {
+    r.mask = mask
+}
+
+// Replaces redacted values with "[hash:" followed by the first 16 hex digits
+// of the HMAC-SHA256 of the value keyed with salt, and a closing "]", instead
+// of the mask. A nil or empty salt turns hashing off.
+func (r *Redactor) SetHashSalt(salt []byte) {
+    r.salt = salt
+}
+
+// Returns s with all redaction rules applied.
+func (r *Redactor) Redact(s string) string {
+    if r == nil || s == "" {
+        return s
+    }
+
+    if r.key_re != nil {
+        s = r.key_re.ReplaceAllStringFunc(s, func(m string) string {
+            parts := r.key_re.FindStringSubmatch(m)
+            key_part, val := parts[1], parts[2]
+            if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') {
+                q := val[:1]
+                return key_part + q + r.replacement(val[1:len(val) - 1]) + q
+            }
+            return key_part + r.replacement(val)
+        })
+    }
+
+    for _, re := range r.patterns {
+        s = re.ReplaceAllStringFunc(s, r.replacement)
+    }
+
+    if r.detect_cards {
+        s = card_re.ReplaceAllStringFunc(s, func(m string) string {
+            if !is_card_number(m) {
+                return m
+            }
+            return r.replacement(m)
+        })
+    }
+
+    return s
+}
+
+// Reports whether values of fields with the given key are to be redacted.
+func (r *Redactor) is_redacted_key(key string) bool {
+    key = strings.ToLower(key)
+    for _, k := range r.keys {
+        if strings.Contains(key, k) {
+            return true
+        }
+    }
+
+    return false
+}
+
+func (r *Redactor) replacement(s string) string {
+    if len(r.salt) == 0 {
+        return r.mask
+    }
+
+    mac := hmac.New(sha256.New, r.salt)
+    mac.Write([]byte(s))
+
+    return "[hash:" + hex.EncodeToString(mac.Sum(nil))[:16] + "]"
+}
+
+// Returns a copy of fields with Redactable values replaced and, if r is not
+// nil, its rules applied. Fields of other types that contain nothing to redact
+// keep their original values, so that they are still encoded as such.
+func (r *Redactor) redact_fields(fields []Field) []Field {
+    var out []Field
+    for i, field := range fields {
+        val := field.Value
+        changed := false
+        if rv, ok := val.(Redactable); ok {
+            val, changed = rv.Redacted(), true
+        }
+        if r != nil {
+            var redacted bool
+            val, redacted = r.redact_value(field.Key, val)
+            changed = changed || redacted
+        }
+        if !changed {
+            continue
+        }
+        if out == nil {
+            out = make([]Field, len(fields))
+            copy(out, fields)
+        }
+        out[i].Value = val
+    }
+    if out == nil {
+        return fields
+    }
+
+    return out
+}
+
+// Applies the rules to a field value, reporting whether it was changed.
+func (r *Redactor) redact_value(key string, v interface{}) (interface{},
+    bool) {
+
+    if v == nil {
+        return v, false
+    }
+    if r.is_redacted_key(key) {
+        return r.replacement(field_string(v)), true
+    }
+
+    switch v.(type) {
+    case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32,
+        uint64, float32, float64:
+        return v, false
+    }
+
+    s := field_string(v)
+    if redacted := r.Redact(s); redacted != s {
+        return redacted, true
+    }
+
+    return v, false
+}
+
+// Checks the digits in s, ignoring spaces and dashes, with the Luhn algorithm.
+func is_card_number(s string) bool {
+    sum := 0
+    num_digits := 0
+    double := false
+    for i := len(s) - 1; i >= 0; i-- {
+        c := s[i]
+        if c < '0' || c > '9' {
+            continue
+        }
+        d := int(c - '0')
+        if double {
+            d *= 2
+            if d > 9 {
+                d -= 9
+            }
+        }
+        sum += d
+        double = !double
+        num_digits++
+    }
+
+    return num_digits >= 13 && num_digits <= 19 && sum % 10 == 0
+}
+
+// Returns v with any Redactable values replaced by their Redacted() form. The
+// slice is only copied if there is something to replace.
+func redact_args(v []interface{}) []interface{} {
+    var out []interface{}
+    for i, arg := range v {
+        rv, ok := arg.(Redactable)
+        if !ok {
+            continue
+        }
+        if out == nil {
+            out = make([]interface{}, len(v))
+            copy(out, v)
+        }
+        out[i] = rv.Redacted()
+    }
+    if out == nil {
+        return v
+    }
+
+    return out
+}
+
+func sprint(v ...interface{}) string {
+    return fmt.Sprint(redact_args(v)...)
+}
+
+func sprintln(v ...interface{}) string {
+    return fmt.Sprintln(redact_args(v)...)
+}
+
+func sprintf(format string, v ...interface{}) string {
+    return fmt.Sprintf(format, redact_args(v)...)
+}
@@ -0,0 +1,150 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+type RedactTest struct {
+    Name string
+    Input string
+    Expected string
+}
+
+type Secret string
+
+func (s Secret) Redacted() string {
+    return "<secret>"
+}
+
+func TestRedact(t *testing.T) {
+    r := log.NewRedactor()
+    if err := r.AddPattern(log.EmailPattern); err != nil {
+        t.Fatalf("couldn't add pattern: %s", err)
+    }
+
+    tests := []*RedactTest{
+        &RedactTest{"key=value", "user=bob password=hunter2 ok",
+            "user=bob password=[REDACTED] ok"},
+        &RedactTest{"json", `{"user":"bob","api_key":"abc\"def"}`,
+            `{"user":"bob","api_key":"[REDACTED]"}`},
+        &RedactTest{"header",
+            "map[Authorization:[Bearer abc.def] Accept:[*/*]]",
+            "map[Authorization:[[REDACTED]] Accept:[*/*]]"},
+        &RedactTest{"struct", "&{User:bob DBPassword:hunter2}",
+            "&{User:bob DBPassword:[REDACTED]}"},
+        &RedactTest{"email", "sent to bob.smith@example.com today",
+            "sent to [REDACTED] today"},
+        &RedactTest{"card", "card 4111 1111 1111 1111 charged",
+            "card [REDACTED] charged"},
+        &RedactTest{"not a card", "order 4111111111111112 shipped",
+            "order 4111111111111112 shipped"},
+    }
+
+    for _, tester := range tests {
+        t.Run(tester.Name, func(t *testing.T) {
+            got := r.Redact(tester.Input)
+            if got != tester.Expected {
+                t.Errorf("got %q, expected %q", got, tester.Expected)
+            }
+        })
+    }
+}
+
+func TestRedactHash(t *testing.T) {
+    r := log.NewRedactor()
+    r.SetHashSalt([]byte("salt"))
+
+    a := r.Redact("token=abc")
+    b := r.Redact("token=abc")
+    c := r.Redact("token=abd")
+    if a != b {
+        t.Errorf("hashes differ for the same value: %q, %q", a, b)
+    }
+    if a == c {
+        t.Errorf("hashes match for different values: %q", a)
+    }
+    if !strings.HasPrefix(a, "token=[hash:") || strings.Contains(a, "abc") {
+        t.Errorf("unexpected hashed output %q", a)
+    }
+}
+
+func TestLoggerRedact(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    logger.SetTimestampFunc(nil)
+    logger.SetFormat(log.FormatLogfmt)
+    logger.SetRedactor(log.NewRedactor())
+
+    req, _ := http.NewRequest("GET", "http://example.com/", nil)
+    req.Header.Set("Authorization", "Bearer sekrit")
+    logger.With("password", "hunter2", "user", "bob").Infof("%v %s",
+        req.Header, Secret("hunter3"))
+
+    output := buffer.String()
+    for _, leak := range []string{"sekrit", "hunter2", "hunter3"} {
+        if strings.Contains(output, leak) {
+            t.Errorf("output contains %q: %q", leak, output)
+        }
+    }
+    for _, want := range []string{"<secret>", "password=[REDACTED]",
+        "user=bob"} {
+        if !strings.Contains(output, want) {
+            t.Errorf("output doesn't contain %q: %q", want, output)
+        }
+    }
+}
+
+func TestRedactableWithoutRedactor(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    logger.SetTimestampFunc(nil)
+    logger.With("key", Secret("a")).Print("value: ", Secret("b"))
+
+    output := buffer.String()
+    if !strings.Contains(output, "value: <secret> key=<secret>") {
+        t.Errorf("unexpected output %q", output)
+    }
+}
+
+func TestRedactSyslog(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(&SyslogLikeLogger{buffer}, log.LOG_DEBUG, "p: ")
+    logger.SetRedactor(log.NewRedactor())
+    logger.Errf("login failed: password=%s", "hunter2")
+
+    output := buffer.String()
+    if strings.Contains(output, "hunter2") ||
+        !strings.Contains(output, "password=[REDACTED]") {
+        t.Errorf("unexpected output %q", output)
+    }
+}
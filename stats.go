@@ -0,0 +1,162 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "expvar"
+    "fmt"
+    "sync"
+    "sync/atomic"
+)
+
+// A Stats is a snapshot of a logger's message counters. The counters are
+// shared by a logger and all of the loggers created from it with Named() or
+// With(), as they share the Writer.
+type Stats struct {
+    // Messages written and messages dropped for being below the severity
+    // threshold, by severity name ("emerg" through "debug"). Messages logged
+    // without a severity, e.g., with Print(), are counted under "none".
+    Emitted map[string]uint64 `json:"emitted"`
+    Suppressed map[string]uint64 `json:"suppressed"`
+
+    // Bytes successfully written to the Writer, and failed writes.
+    BytesWritten uint64 `json:"bytes_written"`
+    WriteErrors uint64 `json:"write_errors"`
+
+    // Messages that could not be written to the Writer or to the fallback
+    // writer. See SetFallbackWriter().
+    Lost uint64 `json:"lost"`
+}
+
+// Index 0 is for messages without a severity, and index sev + 1 for the
+// severity sev. The counters are updated atomically rather than under the
+// logger's lock.
+type logger_stats struct {
+    emitted [9]uint64
+    suppressed [9]uint64
+    bytes_written uint64
+    write_errors uint64
+    lost uint64
+}
+
+const sev_none_name = "none"
+
+func stats_index(sev Severity) int {
+    i := int(sev) + 1
+    if i < 0 || i >= len(sev_names) + 1 {
+        return -1
+    }
+
+    return i
+}
+
+func (s *logger_stats) count_emitted(sev Severity) {
+    if i := stats_index(sev); i >= 0 {
+        atomic.AddUint64(&s.emitted[i], 1)
+    }
+}
+
+func (s *logger_stats) count_suppressed(sev Severity) {
+    if i := stats_index(sev); i >= 0 {
+        atomic.AddUint64(&s.suppressed[i], 1)
+    }
+}
+
+func (s *logger_stats) count_write(n int, err error) {
+    if n > 0 {
+        atomic.AddUint64(&s.bytes_written, uint64(n))
+    }
+    if err != nil {
+        atomic.AddUint64(&s.write_errors, 1)
+    }
+}
+
+func (s *logger_stats) count_lost() {
+    atomic.AddUint64(&s.lost, 1)
+}
+
+// Syslog methods don't report the number of bytes written, so the length of
+// the message is counted on success.
+func (s *logger_stats) count_syslog_write(m string, err error) {
+    if err != nil {
+        s.count_write(0, err)
+        return
+    }
+    s.count_write(len(m), nil)
+}
+
+// Returns a snapshot of the logger's message counters.
+func (l *Logger) Stats() *Stats {
+    s := l.core.stats
+    stats := &Stats{
+        Emitted: make(map[string]uint64, len(s.emitted)),
+        Suppressed: make(map[string]uint64, len(s.suppressed)),
+        BytesWritten: atomic.LoadUint64(&s.bytes_written),
+        WriteErrors: atomic.LoadUint64(&s.write_errors),
+        Lost: atomic.LoadUint64(&s.lost),
+    }
+    for i := range s.emitted {
+        name := sev_none_name
+        if i > 0 {
+            name = Severity(i - 1).name()
+        }
+        stats.Emitted[name] = atomic.LoadUint64(&s.emitted[i])
+        stats.Suppressed[name] = atomic.LoadUint64(&s.suppressed[i])
+    }
+
+    return stats
+}
+
+// Serializes PublishStats(), so that checking for an existing variable and
+// publishing one can't race.
+var publish_lock sync.Mutex
+
+// Publishes the logger's Stats through the expvar package under the given
+// name, so that they are served as JSON at /debug/vars. An error is returned
+// if a variable with that name has already been published.
+func (l *Logger) PublishStats(name string) (err error) {
+    publish_lock.Lock()
+    defer publish_lock.Unlock()
+
+    if expvar.Get(name) != nil {
+        return fmt.Errorf("Expvar variable %q is already published", name)
+    }
+
+    // The name may still be published outside of this package in the
+    // meantime, in which case expvar.Publish() panics.
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("Couldn't publish expvar variable %q: %v", name,
+                r)
+        }
+    }()
+    expvar.Publish(name, expvar.Func(func() interface{} {
+        return l.Stats()
+    }))
+
+    return nil
+}
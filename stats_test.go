@@ -0,0 +1,130 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "expvar"
+    "fmt"
+    log "github.com/cuberat/go-log"
+    "sync/atomic"
+    "testing"
+)
+
+type FailingWriter struct{}
+
+func (w *FailingWriter) Write(b []byte) (int, error) {
+    return 0, errors.New("write failed")
+}
+
+func TestStats(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_WARNING, "p: ")
+    child := logger.Named("child")
+
+    logger.Err("one")
+    child.Err("two")
+    logger.Warning("three")
+    logger.Info("four")
+    child.Debugf("%s", "five")
+    logger.Print("six")
+
+    stats := logger.Stats()
+    check := func(what string, got, expected uint64) {
+        if got != expected {
+            t.Errorf("%s: got %d, expected %d", what, got, expected)
+        }
+    }
+    check("emitted err", stats.Emitted["err"], 2)
+    check("emitted warning", stats.Emitted["warning"], 1)
+    check("emitted none", stats.Emitted["none"], 1)
+    check("emitted info", stats.Emitted["info"], 0)
+    check("suppressed info", stats.Suppressed["info"], 1)
+    check("suppressed debug", stats.Suppressed["debug"], 1)
+    check("suppressed err", stats.Suppressed["err"], 0)
+    check("bytes written", stats.BytesWritten, uint64(buffer.Len()))
+    check("write errors", stats.WriteErrors, 0)
+
+    failing := log.New(new(FailingWriter), log.LOG_DEBUG, "p: ")
+    failing.Info("lost")
+    check("failed write errors", failing.Stats().WriteErrors, 1)
+}
+
+// expvar names can't be unpublished, so each run of a test, e.g., with
+// -count, needs a new one.
+var expvar_seq int32
+
+func unique_expvar_name(t *testing.T) string {
+    return fmt.Sprintf("%s_%d", t.Name(), atomic.AddInt32(&expvar_seq, 1))
+}
+
+func TestPublishStats(t *testing.T) {
+    name := unique_expvar_name(t)
+    logger := log.New(new(bytes.Buffer), log.LOG_DEBUG, "p: ")
+    if err := logger.PublishStats(name); err != nil {
+        t.Fatalf("couldn't publish stats: %s", err)
+    }
+    if err := logger.PublishStats(name); err == nil {
+        t.Errorf("expected an error publishing the same name twice")
+    }
+
+    logger.Crit("something")
+
+    stats := new(log.Stats)
+    data := expvar.Get(name).String()
+    if err := json.Unmarshal([]byte(data), stats); err != nil {
+        t.Fatalf("couldn't decode published stats %q: %s", data, err)
+    }
+    if stats.Emitted["crit"] != 1 {
+        t.Errorf("published stats have %d crit messages, expected 1",
+            stats.Emitted["crit"])
+    }
+}
+
+func TestPublishStatsConcurrent(t *testing.T) {
+    const n = 10
+    name := unique_expvar_name(t)
+    errs := make(chan error, n)
+    for i := 0; i < n; i++ {
+        go func() {
+            logger := log.New(new(bytes.Buffer), log.LOG_DEBUG, "p: ")
+            errs <- logger.PublishStats(name)
+        }()
+    }
+
+    published := 0
+    for i := 0; i < n; i++ {
+        if err := <-errs; err == nil {
+            published++
+        }
+    }
+    if published != 1 {
+        t.Errorf("published %d times, expected once", published)
+    }
+}
@@ -0,0 +1,305 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log
+
+import (
+    "io"
+    "log/syslog"
+    "net"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// A SyslogWriter sends log records to syslog with the priority built from the
+// record's severity and facility, so that a Logger can log to any facility
+// without setting up a log/syslog Writer by hand, e.g.,
+//
+//   w, err := log.NewSyslogWriter(log.LOG_LOCAL6, "myapp")
+//   if err != nil {
+//       ...
+//   }
+//   logger := log.New(w, log.LOG_INFO, "")
+//
+// Records use the facility set on the Logger with SetFacility(), if any, and
+// otherwise the facility the SyslogWriter was created with. As syslog adds
+// its own timestamp and tag, these are left out of the message, along with the
+// logger's prefix. Otherwise, messages are formatted with the logger's flags
+// and multi-line policy, as for any other syslog writer.
+//
+// The local syslog server is sent RFC 3164 messages using log/syslog. Over TCP
+// or UDP, messages are sent in the RFC 5424 format, with the trace and span
+// IDs of the record, if any, as structured data (see TraceSDID). Over TCP,
+// they are framed with octet counting, as in RFC 6587.
+type SyslogWriter struct {
+    network string
+    raddr string
+    tag string
+    facility Facility
+    lock sync.Mutex
+    writers map[Facility]*syslog.Writer
+
+    // The connection and header fields for RFC 5424.
+    rfc5424 bool
+    stream bool
+    conn net.Conn
+    hostname string
+}
+
+// Creates a SyslogWriter connected to the local syslog server, with the given
+// default facility. If tag is empty, the program name is used.
+func NewSyslogWriter(facility Facility, tag string) (*SyslogWriter, error) {
+    return DialSyslog("", "", facility, tag)
+}
+
+// Creates a SyslogWriter connected to the syslog server at address raddr on
+// the given network, as for syslog.Dial(). If network is empty, the local
+// syslog server is used. On "tcp" and "udp" networks (including "tcp4" and so
+// on), messages are sent in the RFC 5424 format.
+func DialSyslog(network, raddr string, facility Facility,
+    tag string) (*SyslogWriter, error) {
+
+    w := &SyslogWriter{network: network, raddr: raddr, tag: tag,
+        facility: facility, writers: make(map[Facility]*syslog.Writer)}
+    if !strings.HasPrefix(network, "tcp") &&
+        !strings.HasPrefix(network, "udp") {
+
+        if _, err := w.get_writer(facility); err != nil {
+            return nil, err
+        }
+        return w, nil
+    }
+
+    w.rfc5424 = true
+    w.stream = strings.HasPrefix(network, "tcp")
+    if w.tag == "" {
+        w.tag = filepath.Base(os.Args[0])
+    }
+    w.hostname, _ = os.Hostname()
+    if err := w.connect(); err != nil {
+        return nil, err
+    }
+
+    return w, nil
+}
+
+// Connects to the syslog server for RFC 5424. Must be called with the lock
+// held, except from DialSyslog().
+func (w *SyslogWriter) connect() error {
+    conn, err := net.Dial(w.network, w.raddr)
+    if err != nil {
+        return err
+    }
+    w.conn = conn
+
+    return nil
+}
+
+// Returns the log/syslog Writer for a facility, connecting it if necessary,
+// since a log/syslog Writer only sends to a single facility.
+func (w *SyslogWriter) get_writer(facility Facility) (*syslog.Writer, error) {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    if sw, ok := w.writers[facility]; ok {
+        return sw, nil
+    }
+
+    sw, err := syslog.Dial(w.network, w.raddr,
+        syslog.Priority(MakePriority(facility, LOG_INFO)), w.tag)
+    if err != nil {
+        return nil, err
+    }
+    w.writers[facility] = sw
+
+    return sw, nil
+}
+
+// Sends a record to syslog, formatted with the default flags. A Logger
+// writing to a SyslogWriter formats its records with its own flags and
+// multi-line policy instead.
+func (w *SyslogWriter) WriteRecord(rec *Record) error {
+    return w.write_syslog(rec, format_text(&record{Record: rec,
+        flags: default_flags, trace_sd: true}))
+}
+
+// Sends m, formatted from rec, to syslog with the priority for rec.
+func (w *SyslogWriter) write_syslog(rec *Record, m string) error {
+    facility := w.facility
+    if rec.HasFacility() {
+        facility = rec.Facility
+    }
+
+    if w.rfc5424 {
+        sev := rec.Severity
+        if !rec.HasSeverity() {
+            sev = LOG_INFO
+        }
+
+        // The message starts with the structured data, as for RFC 3164, so
+        // move it to its place in the header.
+        sd, _ := trace_sd_element(rec.Fields)
+        if sd != "" && strings.HasPrefix(m, sd + " ") {
+            m = m[len(sd) + 1:]
+        } else {
+            sd = "-"
+        }
+
+        return w.send_rfc5424(MakePriority(facility, sev), rec.Time, sd, m)
+    }
+
+    sw, err := w.get_writer(facility)
+    if err != nil {
+        return err
+    }
+
+    switch rec.Severity {
+    case LOG_EMERG:
+        return sw.Emerg(m)
+    case LOG_ALERT:
+        return sw.Alert(m)
+    case LOG_CRIT:
+        return sw.Crit(m)
+    case LOG_ERR:
+        return sw.Err(m)
+    case LOG_WARNING:
+        return sw.Warning(m)
+    case LOG_NOTICE:
+        return sw.Notice(m)
+    case LOG_DEBUG:
+        return sw.Debug(m)
+    }
+
+    return sw.Info(m)
+}
+
+// Sends an RFC 5424 message, reconnecting once if the write fails, as
+// log/syslog does.
+func (w *SyslogWriter) send_rfc5424(pri Priority, t time.Time, sd,
+    m string) error {
+
+    if t.IsZero() {
+        t = time.Now()
+    }
+
+    msg := "<" + strconv.Itoa(int(pri)) + ">1 " +
+        t.Format(rfc5424_time_layout) + " " +
+        rfc5424_header_field(w.hostname, 255) + " " +
+        rfc5424_header_field(w.tag, 48) + " " +
+        strconv.Itoa(os.Getpid()) + " - " + sd + " " +
+        strings.TrimSuffix(m, "\n")
+    if w.stream {
+        msg = strconv.Itoa(len(msg)) + " " + msg
+    }
+
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    if w.conn != nil {
+        if _, err := io.WriteString(w.conn, msg); err == nil {
+            return nil
+        }
+        w.conn.Close()
+        w.conn = nil
+    }
+    if err := w.connect(); err != nil {
+        return err
+    }
+    _, err := io.WriteString(w.conn, msg)
+
+    return err
+}
+
+// The RFC 5424 timestamp layout, which allows at most microseconds.
+const rfc5424_time_layout = "2006-01-02T15:04:05.000000Z07:00"
+
+// Returns s as an RFC 5424 header field of at most max_len printable ASCII
+// characters, replacing others with underscores. An empty field is "-".
+func rfc5424_header_field(s string, max_len int) string {
+    if s == "" {
+        return "-"
+    }
+
+    b := []byte(s)
+    if len(b) > max_len {
+        b = b[:max_len]
+    }
+    for i, c := range b {
+        if c < 33 || c > 126 {
+            b[i] = '_'
+        }
+    }
+
+    return string(b)
+}
+
+// Sends b to syslog with the default facility and severity LOG_INFO.
+func (w *SyslogWriter) Write(b []byte) (int, error) {
+    if w.rfc5424 {
+        err := w.send_rfc5424(MakePriority(w.facility, LOG_INFO),
+            time.Time{}, "-", string(b))
+        if err != nil {
+            return 0, err
+        }
+        return len(b), nil
+    }
+
+    sw, err := w.get_writer(w.facility)
+    if err != nil {
+        return 0, err
+    }
+
+    return sw.Write(b)
+}
+
+// Closes the connections to syslog.
+func (w *SyslogWriter) Close() error {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+
+    var first_err error
+    for facility, sw := range w.writers {
+        if err := sw.Close(); err != nil && first_err == nil {
+            first_err = err
+        }
+        delete(w.writers, facility)
+    }
+    if w.conn != nil {
+        if err := w.conn.Close(); err != nil && first_err == nil {
+            first_err = err
+        }
+        w.conn = nil
+    }
+
+    return first_err
+}
@@ -0,0 +1,215 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log_test
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    log "github.com/cuberat/go-log"
+    "io"
+    "io/ioutil"
+    "net"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestSyslogWriter(t *testing.T) {
+    dir, err := ioutil.TempDir("", "go-log-syslog")
+    if err != nil {
+        t.Fatalf("couldn't create temp dir: %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    path := filepath.Join(dir, "syslog.sock")
+    conn, err := net.ListenUnixgram("unixgram",
+        &net.UnixAddr{Name: path, Net: "unixgram"})
+    if err != nil {
+        t.Fatalf("couldn't listen on %s: %s", path, err)
+    }
+    defer conn.Close()
+
+    read := func() string {
+        buf := make([]byte, 4096)
+        conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+        n, err := conn.Read(buf)
+        if err != nil {
+            t.Fatalf("couldn't read syslog message: %s", err)
+        }
+        return string(buf[:n])
+    }
+
+    w, err := log.DialSyslog("unixgram", path, log.LOG_LOCAL6, "myapp")
+    if err != nil {
+        t.Fatalf("couldn't create syslog writer: %s", err)
+    }
+    defer w.Close()
+
+    logger := log.New(w, log.LOG_DEBUG, "p: ")
+    logger.Err("first")
+    msg := read()
+    if !strings.HasPrefix(msg, "<179>") || !strings.Contains(msg, " myapp[") ||
+        !strings.Contains(msg, "syslog_test.go:") ||
+        !strings.HasSuffix(msg, ": first\n") || strings.Contains(msg, "p: ") {
+        t.Errorf("unexpected message %q", msg)
+    }
+
+    logger.SetFacility(log.LOG_DAEMON)
+    logger.Info("second")
+    if msg = read(); !strings.HasPrefix(msg, "<30>") {
+        t.Errorf("expected priority <30>, got %q", msg)
+    }
+
+    logger.SetMultilinePolicy(log.MultilineEscape)
+    logger.Info("line1\nFAKE line2")
+    if msg = read(); !strings.HasSuffix(msg, ": line1\\nFAKE line2\n") {
+        t.Errorf("expected an escaped newline, got %q", msg)
+    }
+
+    logger.SetMultilinePolicy(log.MultilineRepeatHeader)
+    logger.Info("one\ntwo")
+    first, second := read(), read()
+    if !strings.HasSuffix(first, ": one\n") ||
+        !strings.HasSuffix(second, ": two\n") ||
+        !strings.Contains(second, "syslog_test.go:") {
+        t.Errorf("expected a header on each line, got %q and %q", first,
+            second)
+    }
+
+    logger.SetFlags(0)
+    logger.Info("no source")
+    if msg = read(); strings.Contains(msg, "syslog_test.go:") {
+        t.Errorf("expected no source with no flags, got %q", msg)
+    }
+}
+
+func TestSyslogWriterRFC5424TCP(t *testing.T) {
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("couldn't listen: %s", err)
+    }
+    defer ln.Close()
+
+    w, err := log.DialSyslog("tcp", ln.Addr().String(), log.LOG_LOCAL6,
+        "myapp")
+    if err != nil {
+        t.Fatalf("couldn't create syslog writer: %s", err)
+    }
+    defer w.Close()
+
+    conn, err := ln.Accept()
+    if err != nil {
+        t.Fatalf("couldn't accept connection: %s", err)
+    }
+    defer conn.Close()
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    r := bufio.NewReader(conn)
+
+    // Reads a message framed with octet counting.
+    read := func() string {
+        size, err := r.ReadString(' ')
+        if err != nil {
+            t.Fatalf("couldn't read message length: %s", err)
+        }
+        n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+        if err != nil {
+            t.Fatalf("invalid message length %q", size)
+        }
+        buf := make([]byte, n)
+        if _, err := io.ReadFull(r, buf); err != nil {
+            t.Fatalf("couldn't read message: %s", err)
+        }
+        return string(buf)
+    }
+
+    logger := log.New(w, log.LOG_DEBUG, "p: ")
+    ctx := log.ContextWithTraceparent(context.Background(), test_traceparent)
+    logger.WithContext(ctx).With("user", "bob").Err("traced")
+
+    header := fmt.Sprintf(" myapp %d - [trace@32473 trace_id=\"%s\" " +
+        "span_id=\"%s\"] syslog_test.go:", os.Getpid(), test_trace_id,
+        test_span_id)
+    msg := read()
+    if !strings.HasPrefix(msg, "<179>1 ") ||
+        !strings.Contains(msg, header) ||
+        !strings.HasSuffix(msg, ": traced user=bob") ||
+        strings.Contains(msg, "p: ") {
+        t.Errorf("unexpected message %q", msg)
+    }
+
+    logger.Info("untraced\nsecond line")
+    if msg = read(); !strings.HasPrefix(msg, "<182>1 ") ||
+        !strings.Contains(msg, " - - syslog_test.go:") ||
+        !strings.HasSuffix(msg, ": untraced\nsecond line") {
+        t.Errorf("unexpected message without trace %q", msg)
+    }
+
+    fmt.Fprint(w, "written")
+    if msg = read(); !strings.HasPrefix(msg, "<182>1 ") ||
+        !strings.HasSuffix(msg, " - - written") {
+        t.Errorf("unexpected message from Write %q", msg)
+    }
+}
+
+func TestSyslogWriterRFC5424UDP(t *testing.T) {
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("couldn't listen: %s", err)
+    }
+    defer conn.Close()
+
+    w, err := log.DialSyslog("udp", conn.LocalAddr().String(), log.LOG_DAEMON,
+        "")
+    if err != nil {
+        t.Fatalf("couldn't create syslog writer: %s", err)
+    }
+    defer w.Close()
+
+    logger := log.New(w, log.LOG_DEBUG, "")
+    logger.Warning("over udp")
+
+    buf := make([]byte, 4096)
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    n, _, err := conn.ReadFrom(buf)
+    if err != nil {
+        t.Fatalf("couldn't read syslog message: %s", err)
+    }
+    msg := string(buf[:n])
+    tag := filepath.Base(os.Args[0])
+    if !strings.HasPrefix(msg, "<28>1 ") ||
+        !strings.Contains(msg, " " + tag + " ") ||
+        !strings.HasSuffix(msg, ": over udp") {
+        t.Errorf("unexpected message %q", msg)
+    }
+}
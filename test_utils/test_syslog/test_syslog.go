@@ -3,11 +3,10 @@ package main
 import (
     "fmt"
     log "github.com/cuberat/go-log"
-    syslog "log/syslog"
 )
 
 func main() {
-    sys_logger, err := syslog.New(syslog.LOG_INFO | syslog.LOG_LOCAL6, "foo-> ")
+    sys_logger, err := log.NewSyslogWriter(log.LOG_LOCAL6, "foo-> ")
     if err != nil {
         panic(fmt.Sprintf("Couldn't connect to syslog: %s", err))
     }
@@ -0,0 +1,143 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Layouts used by the timestamp generators below.
+const (
+    LayoutRFC3339Milli = "2006-01-02T15:04:05.000Z07:00"
+    LayoutRFC3339Micro = "2006-01-02T15:04:05.000000Z07:00"
+    LayoutRFC3339Nano = "2006-01-02T15:04:05.000000000Z07:00"
+    LayoutLocal = "2006-01-02 15:04:05.000 MST"
+)
+
+var ts_presets = map[string]TimestampFunc{
+    "rfc3339": TimestampRFC3339,
+    "rfc3339milli": TimestampRFC3339Milli,
+    "rfc3339micro": TimestampRFC3339Micro,
+    "rfc3339nano": TimestampRFC3339Nano,
+    "local": TimestampLocal,
+    "unix": TimestampUnix,
+    "unixmilli": TimestampUnixMilli,
+    "syslog": TimestampSyslog,
+    "isoweek": TimestampISOWeek,
+}
+
+// Returns a timestamp generator that formats the time with the given layout,
+// in the manner of time.Format().
+func TimestampLayout(layout string) TimestampFunc {
+    return func(t time.Time) string {
+        return t.Format(layout)
+    }
+}
+
+// Returns a timestamp generator that converts the time to the location loc
+// before passing it to f. This allows a single logger to use a different time
+// zone than the one set with SetTimeLocation().
+func TimestampInLocation(loc *time.Location, f TimestampFunc) TimestampFunc {
+    return func(t time.Time) string {
+        return f(t.In(loc))
+    }
+}
+
+// Looks up a timestamp generator by name. The names are "rfc3339",
+// "rfc3339milli", "rfc3339micro", "rfc3339nano", "local", "unix", "unixmilli",
+// "syslog", and "isoweek", corresponding to the Timestamp* functions in this
+// package.
+func TimestampFuncFromString(name string) (TimestampFunc, error) {
+    if f, ok := ts_presets[strings.ToLower(name)]; ok {
+        return f, nil
+    }
+
+    return nil, fmt.Errorf("Unknown timestamp format %q", name)
+}
+
+// Formats the time per RFC 3339 with second resolution, e.g.,
+// "2020-09-09T13:04:05Z". This is the default.
+func TimestampRFC3339(t time.Time) string {
+    return t.Format(time.RFC3339)
+}
+
+// Formats the time per RFC 3339 with millisecond resolution, e.g.,
+// "2020-09-09T13:04:05.123Z".
+func TimestampRFC3339Milli(t time.Time) string {
+    return t.Format(LayoutRFC3339Milli)
+}
+
+// Formats the time per RFC 3339 with microsecond resolution, e.g.,
+// "2020-09-09T13:04:05.123456Z".
+func TimestampRFC3339Micro(t time.Time) string {
+    return t.Format(LayoutRFC3339Micro)
+}
+
+// Formats the time per RFC 3339 with nanosecond resolution, e.g.,
+// "2020-09-09T13:04:05.123456789Z". Unlike time.RFC3339Nano, trailing zeros
+// are kept, so that timestamps line up.
+func TimestampRFC3339Nano(t time.Time) string {
+    return t.Format(LayoutRFC3339Nano)
+}
+
+// Formats the time in the local time zone with the zone name, e.g.,
+// "2020-09-09 09:04:05.123 EDT", regardless of the logger's time location.
+func TimestampLocal(t time.Time) string {
+    return t.Local().Format(LayoutLocal)
+}
+
+// Formats the time as seconds since the Unix epoch, e.g., "1599656645".
+func TimestampUnix(t time.Time) string {
+    return strconv.FormatInt(t.Unix(), 10)
+}
+
+// Formats the time as milliseconds since the Unix epoch, e.g.,
+// "1599656645123".
+func TimestampUnixMilli(t time.Time) string {
+    return strconv.FormatInt(t.UnixNano() / int64(time.Millisecond), 10)
+}
+
+// Formats the time in the traditional syslog style, e.g., "Sep  9 13:04:05".
+func TimestampSyslog(t time.Time) string {
+    return t.Format(time.Stamp)
+}
+
+// Formats the time as an ISO 8601 week date and time, e.g.,
+// "2020-W37-3T13:04:05Z", which makes grouping by week trivial.
+func TimestampISOWeek(t time.Time) string {
+    year, week := t.ISOWeek()
+    weekday := int(t.Weekday())
+    if weekday == 0 {
+        weekday = 7
+    }
+
+    return fmt.Sprintf("%04d-W%02d-%d%s", year, week, weekday,
+        t.Format("T15:04:05Z07:00"))
+}
@@ -0,0 +1,95 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    log "github.com/cuberat/go-log"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestTimestampPresets(t *testing.T) {
+    ts := time.Date(2020, time.September, 9, 13, 4, 5, 123456789, time.UTC)
+
+    tests := map[string]string{
+        "rfc3339": "2020-09-09T13:04:05Z",
+        "rfc3339milli": "2020-09-09T13:04:05.123Z",
+        "rfc3339micro": "2020-09-09T13:04:05.123456Z",
+        "rfc3339nano": "2020-09-09T13:04:05.123456789Z",
+        "unix": "1599656645",
+        "unixmilli": "1599656645123",
+        "syslog": "Sep  9 13:04:05",
+        "isoweek": "2020-W37-3T13:04:05Z",
+    }
+
+    for name, expected := range tests {
+        ts_func, err := log.TimestampFuncFromString(name)
+        if err != nil {
+            t.Errorf("couldn't look up timestamp format %q: %s", name, err)
+            continue
+        }
+        if got := ts_func(ts); got != expected {
+            t.Errorf("timestamp format %q: got %q, expected %q", name, got,
+                expected)
+        }
+    }
+
+    if _, err := log.TimestampFuncFromString("sundial"); err == nil {
+        t.Errorf("expected error for unknown timestamp format")
+    }
+}
+
+func TestTimeLocation(t *testing.T) {
+    loc := time.FixedZone("XYZ", -5 * 3600)
+
+    var got_time time.Time
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "")
+    logger.SetTimeLocation(loc)
+    logger.SetTimestampFunc(func(ts time.Time) string {
+        got_time = ts
+        return log.TimestampRFC3339(ts)
+    })
+
+    logger.Info("foo")
+
+    if got_time.Location() != loc {
+        t.Errorf("timestamp func got time in %s, expected %s",
+            got_time.Location(), loc)
+    }
+    if !strings.Contains(buffer.String(), "-05:00 ") {
+        t.Errorf("expected timestamp with -05:00 offset, got %q",
+            buffer.String())
+    }
+
+    in_utc := log.TimestampInLocation(time.UTC, log.TimestampRFC3339)
+    if got := in_utc(got_time); !strings.HasSuffix(got, "Z") {
+        t.Errorf("expected UTC timestamp, got %q", got)
+    }
+}
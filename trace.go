@@ -0,0 +1,241 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+// Keys of the fields added by WithContext() and WithRequest().
+const (
+    TraceIDKey = "trace_id"
+    SpanIDKey = "span_id"
+)
+
+// The SD-ID of the RFC 5424 structured data element in which the trace and
+// span IDs are sent to syslog, e.g.,
+//
+//   [trace@32473 trace_id="..." span_id="..."]
+//
+// A SyslogWriter connected over TCP or UDP with DialSyslog() sends RFC 5424
+// messages with this as their structured data. Other syslog writers, such as
+// log/syslog Writers and a SyslogWriter for the local syslog server, send RFC
+// 3164 messages, which have no structured data, so the element starts the
+// message text instead. The default uses the private enterprise number
+// reserved for documentation; set it to one under your own enterprise number
+// if your syslog server cares.
+var TraceSDID = "trace@32473"
+
+// The name of the HTTP header carrying W3C trace context.
+const TraceparentHeader = "traceparent"
+
+// A TraceContext holds the parts of a W3C traceparent value.
+type TraceContext struct {
+    // Lower-case hex IDs: 32 digits for the trace, 16 for the span.
+    TraceID string
+    SpanID string
+
+    // The trace flags. Bit 0 is the sampled flag.
+    Flags byte
+}
+
+// A TraceExtractor returns the trace and span IDs stored in a context, or
+// empty strings if there are none. Set one with SetTraceExtractor() to use
+// the context keys of a tracing library.
+type TraceExtractor func(ctx context.Context) (trace_id, span_id string)
+
+type trace_ctx_key struct{}
+
+// Parses a W3C traceparent header value, e.g.,
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(traceparent string) (*TraceContext, error) {
+    s := strings.TrimSpace(traceparent)
+    parts := strings.Split(s, "-")
+    if len(parts) < 4 || len(parts[0]) != 2 || !is_lower_hex(parts[0]) {
+        return nil, fmt.Errorf("Invalid traceparent %q", traceparent)
+    }
+    // Later versions may add fields, but version 00 has exactly four.
+    if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+        return nil, fmt.Errorf("Invalid traceparent version in %q",
+            traceparent)
+    }
+
+    tc := &TraceContext{TraceID: parts[1], SpanID: parts[2]}
+    if len(tc.TraceID) != 32 || !is_lower_hex(tc.TraceID) ||
+        tc.TraceID == strings.Repeat("0", 32) {
+        return nil, fmt.Errorf("Invalid trace ID in traceparent %q",
+            traceparent)
+    }
+    if len(tc.SpanID) != 16 || !is_lower_hex(tc.SpanID) ||
+        tc.SpanID == strings.Repeat("0", 16) {
+        return nil, fmt.Errorf("Invalid span ID in traceparent %q",
+            traceparent)
+    }
+    if len(parts[3]) != 2 || !is_lower_hex(parts[3]) {
+        return nil, fmt.Errorf("Invalid trace flags in traceparent %q",
+            traceparent)
+    }
+    fmt.Sscanf(parts[3], "%02x", &tc.Flags)
+
+    return tc, nil
+}
+
+// Returns the trace context in the traceparent header of r.
+func TraceFromRequest(r *http.Request) (*TraceContext, error) {
+    return ParseTraceparent(r.Header.Get(TraceparentHeader))
+}
+
+// Returns the trace context as a traceparent header value.
+func (tc *TraceContext) String() string {
+    return fmt.Sprintf("00-%s-%s-%02x", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// Reports whether the sampled flag is set.
+func (tc *TraceContext) Sampled() bool {
+    return tc.Flags & 0x01 != 0
+}
+
+// Returns a copy of ctx carrying the trace context tc, for use by
+// ExtractTrace().
+func ContextWithTrace(ctx context.Context, tc *TraceContext) context.Context {
+    return context.WithValue(ctx, trace_ctx_key{}, tc)
+}
+
+// Returns a copy of ctx carrying the trace context in a traceparent value. It
+// is parsed when the IDs are extracted, and ignored if it is invalid.
+func ContextWithTraceparent(ctx context.Context,
+    traceparent string) context.Context {
+
+    return context.WithValue(ctx, trace_ctx_key{}, traceparent)
+}
+
+// The default TraceExtractor. It returns the IDs stored in ctx with
+// ContextWithTrace() or ContextWithTraceparent().
+func ExtractTrace(ctx context.Context) (trace_id, span_id string) {
+    switch val := ctx.Value(trace_ctx_key{}).(type) {
+    case *TraceContext:
+        if val != nil {
+            return val.TraceID, val.SpanID
+        }
+    case string:
+        if tc, err := ParseTraceparent(val); err == nil {
+            return tc.TraceID, tc.SpanID
+        }
+    }
+
+    return "", ""
+}
+
+// Sets the function used by WithContext() and WithRequest() to get trace and
+// span IDs from a context. Passing nil restores ExtractTrace().
+func (l *Logger) SetTraceExtractor(f TraceExtractor) {
+    l.core.trace_extractor = f
+}
+
+// Returns a child logger, as with With(), that adds the trace and span IDs
+// found in ctx to every record as the fields trace_id and span_id. If ctx has
+// no trace, l itself is returned.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+    extract := l.core.trace_extractor
+    if extract == nil {
+        extract = ExtractTrace
+    }
+
+    return l.with_trace(extract(ctx))
+}
+
+// Like WithContext(), with the context of r, but falling back to the
+// traceparent header of r if the context has no trace.
+func (l *Logger) WithRequest(r *http.Request) *Logger {
+    child := l.WithContext(r.Context())
+    if child != l {
+        return child
+    }
+
+    tc, err := TraceFromRequest(r)
+    if err != nil {
+        return l
+    }
+
+    return l.with_trace(tc.TraceID, tc.SpanID)
+}
+
+func (l *Logger) with_trace(trace_id, span_id string) *Logger {
+    if trace_id == "" {
+        return l
+    }
+
+    kv := []interface{}{TraceIDKey, trace_id}
+    if span_id != "" {
+        kv = append(kv, SpanIDKey, span_id)
+    }
+
+    return l.With(kv...)
+}
+
+func is_lower_hex(s string) bool {
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+            return false
+        }
+    }
+
+    return true
+}
+
+// Splits the trace fields out of fields and returns them as an RFC 5424
+// structured data element, e.g., `[trace@32473 trace_id="..." span_id="..."]`.
+// The element is empty if there are no trace fields.
+func trace_sd_element(fields []Field) (string, []Field) {
+    var params []string
+    var rest []Field
+    for i, field := range fields {
+        if field.Key != TraceIDKey && field.Key != SpanIDKey {
+            if rest != nil {
+                rest = append(rest, field)
+            }
+            continue
+        }
+        if rest == nil {
+            rest = make([]Field, i, len(fields))
+            copy(rest, fields[:i])
+        }
+        params = append(params, field.Key + `="` +
+            sd_param_escaper.Replace(field_string(field.Value)) + `"`)
+    }
+    if params == nil {
+        return "", fields
+    }
+
+    return "[" + TraceSDID + " " + strings.Join(params, " ") + "]", rest
+}
+
+var sd_param_escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
@@ -0,0 +1,149 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package log_test
+
+import (
+    "bytes"
+    "context"
+    log "github.com/cuberat/go-log"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+const (
+    test_traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+    test_trace_id = "4bf92f3577b34da6a3ce929d0e0e4736"
+    test_span_id = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+    tc, err := log.ParseTraceparent(test_traceparent)
+    if err != nil {
+        t.Fatalf("couldn't parse traceparent: %s", err)
+    }
+    if tc.TraceID != test_trace_id || tc.SpanID != test_span_id ||
+        !tc.Sampled() {
+        t.Errorf("unexpected trace context %+v", tc)
+    }
+    if tc.String() != test_traceparent {
+        t.Errorf("got %q, expected %q", tc.String(), test_traceparent)
+    }
+
+    if _, err := log.ParseTraceparent(test_traceparent + "-extra"); err == nil {
+        t.Errorf("expected an error for extra fields with version 00")
+    }
+
+    // A later version may have more fields.
+    future := "cc" + test_traceparent[2:] + "-extra"
+    if _, err := log.ParseTraceparent(future); err != nil {
+        t.Errorf("couldn't parse future version: %s", err)
+    }
+
+    bad := []string{
+        "",
+        "ff" + test_traceparent[2:],
+        "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+        "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+        "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+        "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+        "00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+    }
+    for _, traceparent := range bad {
+        if _, err := log.ParseTraceparent(traceparent); err == nil {
+            t.Errorf("expected an error for %q", traceparent)
+        }
+    }
+}
+
+func TestWithContext(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    logger.SetTimestampFunc(nil)
+
+    ctx := log.ContextWithTraceparent(context.Background(), test_traceparent)
+    logger.WithContext(ctx).Info("traced")
+    if !strings.HasSuffix(buffer.String(), ": traced trace_id=" +
+        test_trace_id + " span_id=" + test_span_id + "\n") {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+
+    buffer.Reset()
+    logger.SetFormat(log.FormatJSON)
+    tc, _ := log.ParseTraceparent(test_traceparent)
+    logger.WithContext(log.ContextWithTrace(context.Background(), tc)).Info(
+        "traced")
+    if !strings.HasSuffix(buffer.String(), `"msg":"traced","trace_id":"` +
+        test_trace_id + `","span_id":"` + test_span_id + "\"}\n") {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+
+    if logger.WithContext(context.Background()) != logger {
+        t.Errorf("expected the logger itself for a context without a trace")
+    }
+
+    logger.SetTraceExtractor(func(ctx context.Context) (string, string) {
+        id, _ := ctx.Value("my-trace").(string)
+        return id, ""
+    })
+    buffer.Reset()
+    ctx = context.WithValue(context.Background(), "my-trace", "abc")
+    logger.WithContext(ctx).Info("custom")
+    if !strings.HasSuffix(buffer.String(), `"trace_id":"abc"}` + "\n") {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+}
+
+func TestWithRequest(t *testing.T) {
+    buffer := new(bytes.Buffer)
+    logger := log.New(buffer, log.LOG_DEBUG, "p: ")
+    logger.SetFormat(log.FormatLogfmt)
+
+    req, _ := http.NewRequest("GET", "http://example.com/", nil)
+    req.Header.Set(log.TraceparentHeader, test_traceparent)
+    logger.WithRequest(req).Info("request")
+    if !strings.Contains(buffer.String(), " trace_id=" + test_trace_id +
+        " span_id=" + test_span_id) {
+        t.Errorf("unexpected output %q", buffer.String())
+    }
+}
+
+func TestTraceSyslog(t *testing.T) {
+    recorder := new(MethodRecorder)
+    logger := log.New(recorder, log.LOG_DEBUG, "p: ")
+
+    ctx := log.ContextWithTraceparent(context.Background(), test_traceparent)
+    logger.WithContext(ctx).With("user", "bob").Warning("traced")
+
+    expected := `warning: [trace@32473 trace_id="` + test_trace_id +
+        `" span_id="` + test_span_id + `"] trace_test.go:`
+    if len(recorder.Lines) != 1 ||
+        !strings.HasPrefix(recorder.Lines[0], expected) ||
+        !strings.HasSuffix(recorder.Lines[0], ": traced user=bob") {
+        t.Errorf("unexpected syslog calls %q", recorder.Lines)
+    }
+}